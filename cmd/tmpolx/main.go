@@ -17,19 +17,55 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"runtime/debug"
 
 	"flag"
 	"github.com/spf13/pflag"
 
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+	"sigs.k8s.io/yaml"
 
+	"github.com/fromanirh/tmpolx/pkg/cpumanager"
+	"github.com/fromanirh/tmpolx/pkg/kubeletlog"
+	"github.com/fromanirh/tmpolx/pkg/machine"
+	"github.com/fromanirh/tmpolx/pkg/pod"
+	"github.com/fromanirh/tmpolx/pkg/scenario"
 	"github.com/fromanirh/tmpolx/pkg/tmpolx"
 )
 
+// exit codes, to use tmpolx as a predicate in scripts
+const (
+	exitAdmitted = iota
+	exitRejected
+	exitInputError
+	exitInternalError
+	// a scenario failed or a kubelet decision mismatches
+	exitCheckFailed
+)
+
+const exitCodesHelp = `
+Exit codes:
+  0  the hints are admitted, all the scenarios pass, all the kubelet decisions match
+  1  the hints are rejected; comparing policies, any of the compared policies rejects them
+  2  input error
+  3  internal error
+  4  a scenario failed or a kubelet decision mismatches
+`
+
 func main() {
+	// an unrecovered panic exits with code 2, which is taken for an input error
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "internal error: %v\n%s", r, debug.Stack())
+			os.Exit(exitInternalError)
+		}
+	}()
+
 	// Add klog flags
 	klog.InitFlags(flag.CommandLine)
 	// Add flags registered by imported packages
@@ -37,33 +73,459 @@ func main() {
 
 	var numaNodes string
 	var policyName string
+	var policyOptions map[string]string
+	var scopeName string
+	var podFile string
+	var useManager bool
 	var useJSONHints bool
+	var scenarioFile string
+	var kubeletLog string
+	var verify bool
+	var maskFormat string
+	var lenient bool
+	var machineFile string
+	var sysfsDir string
+	var machineInfoFile string
+	var nrtFile string
+	var outputFormat string
+	var explain bool
+	var quiet bool
+	var numaMap bool
+	var sortResources bool
+	var dumpMachine bool
+	var cpuRequest int
+	var availableCPUs string
+	var reservedCPUs string
 	pflag.StringVarP(&numaNodes, "numa", "N", "0-7", "set NUMA configuration")
-	pflag.StringVarP(&policyName, "policy", "P", "none", "set Topology manager Policy")
+	pflag.StringVarP(&policyName, "policy", "P", "none", "set Topology manager Policy; use \"all\" or a comma separated list to compare policies")
+	pflag.StringToStringVar(&policyOptions, "policy-options", nil, "set Topology manager policy options, like "+tmpolx.PreferClosestNUMANodes+"=true")
+	pflag.StringVarP(&scopeName, "scope", "S", tmpolx.ScopeContainer, "set Topology manager scope (container|pod)")
+	pflag.StringVar(&podFile, "pod", "", "admit the pod described in the given file, with the hints of each container")
+	pflag.BoolVar(&useManager, "manager", false, "admit through a real topology manager with scripted hint providers, instead of calling the policy")
+	pflag.IntVar(&cpuRequest, "cpu-request", 0, "generate the cpu hints for the given exclusive cpus request like the static CPU manager policy; needs the machine topology")
+	pflag.StringVar(&availableCPUs, "available-cpus", "", "cpus available for exclusive allocation, used generating the cpu hints (default: all the machine cpus)")
+	pflag.StringVar(&reservedCPUs, "reserved-cpus", "", "cpus reserved for the system, used generating the cpu hints")
 	pflag.BoolVarP(&useJSONHints, "json", "J", false, "interpret hints as JSON")
+	pflag.StringVarP(&machineFile, "machine", "m", "", "load the machine topology from the given file")
+	pflag.StringVar(&sysfsDir, "sysfs", "", "import the machine topology from the given sysfs snapshot")
+	pflag.StringVar(&machineInfoFile, "machine-info", "", "import the machine topology from the given cadvisor MachineInfo JSON")
+	pflag.StringVar(&nrtFile, "nrt", "", "import the machine topology from the given NodeResourceTopology object")
+	pflag.BoolVar(&dumpMachine, "dump-machine", false, "print the machine topology in the machine topology file format and exit")
+	pflag.StringVarP(&scenarioFile, "scenario", "f", "", "run the scenarios described in the given file")
+	pflag.StringVarP(&kubeletLog, "kubelet-log", "L", "", "evaluate the admissions found in the given kubelet log (use - for stdin)")
+	pflag.StringVarP(&maskFormat, "mask-format", "M", "binary", "render NUMA affinity masks as binary, hex or list")
+	pflag.StringVarP(&outputFormat, "output", "o", tmpolx.OutputText, "print the evaluation result as text, json or yaml")
+	pflag.BoolVar(&explain, "explain", false, "trace every hint permutation and how the policy chose the best hint")
+	pflag.BoolVarP(&quiet, "quiet", "q", false, "don't print the hints table nor the kubelet logs")
+	pflag.BoolVar(&numaMap, "map", false, "draw the hints and the best hint on an ASCII map of the NUMA nodes")
+	pflag.BoolVar(&sortResources, "sort", false, "render the resources sorted by name instead of in input order")
+	pflag.BoolVar(&lenient, "lenient", false, "warn about invalid hints instead of failing")
+	pflag.BoolVarP(&verify, "verify", "V", false, "verify the admissions found in the kubelet log against the logged best hints")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		pflag.PrintDefaults()
+		fmt.Fprint(os.Stderr, exitCodesHelp)
+	}
 	pflag.Parse()
 
+	if quiet {
+		klog.LogToStderr(false)
+		klog.SetOutput(io.Discard)
+	}
+
+	if err := tmpolx.ValidateOutputFormat(outputFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(exitInputError)
+	}
+	if countSet(podFile, scenarioFile, kubeletLog) > 1 {
+		fmt.Fprintf(os.Stderr, "--pod, --scenario and --kubelet-log are mutually exclusive\n")
+		os.Exit(exitInputError)
+	}
+	if verify && kubeletLog == "" {
+		fmt.Fprintf(os.Stderr, "--verify needs --kubelet-log\n")
+		os.Exit(exitInputError)
+	}
+	if podFile != "" && (explain || numaMap || pflag.NArg() > 0) {
+		fmt.Fprintf(os.Stderr, "--pod takes the hints from the pod file, and doesn't support hints on the command line, --explain and --map\n")
+		os.Exit(exitInputError)
+	}
+	if cpuRequest == 0 && (availableCPUs != "" || reservedCPUs != "") {
+		fmt.Fprintf(os.Stderr, "--available-cpus and --reserved-cpus need --cpu-request\n")
+		os.Exit(exitInputError)
+	}
+	if cpuRequest != 0 && (podFile != "" || scenarioFile != "" || kubeletLog != "") {
+		fmt.Fprintf(os.Stderr, "--cpu-request is supported only evaluating the hints given on the command line\n")
+		os.Exit(exitInputError)
+	}
+	if useManager && (scenarioFile != "" || kubeletLog != "" || explain || numaMap) {
+		fmt.Fprintf(os.Stderr, "--manager is supported only admitting a pod or the hints given on the command line\n")
+		os.Exit(exitInputError)
+	}
+	if (outputFormat != tmpolx.OutputText || explain || numaMap) && (scenarioFile != "" || kubeletLog != "") {
+		fmt.Fprintf(os.Stderr, "--output, --explain and --map are supported only evaluating the hints given on the command line\n")
+		os.Exit(exitInputError)
+	}
+
+	if scenarioFile != "" {
+		os.Exit(runScenarios(scenarioFile, quiet))
+	}
+
 	numaConf, err := cpuset.Parse(numaNodes)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "bad format for NUMA configuration: %v", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "bad format for NUMA configuration: %v\n", err)
+		os.Exit(exitInputError)
 	}
 
 	params := tmpolx.Params{
-		PolicyName:   policyName,
-		NUMANodes:    numaConf.ToSlice(),
-		RawHints:     pflag.Args(),
-		UseJSONHints: useJSONHints,
+		PolicyName:    policyName,
+		PolicyOptions: policyOptions,
+		ScopeName:     scopeName,
+		UseManager:    useManager,
+		NUMANodes:     numaConf.ToSlice(),
+		RawHints:      pflag.Args(),
+		UseJSONHints:  useJSONHints,
+		MaskFormat:    maskFormat,
+		SortResources: sortResources,
+		Lenient:       lenient,
+	}
+	if cpuRequest != 0 {
+		params.CPURequest = &cpumanager.Request{
+			CPUs:      cpuRequest,
+			Available: availableCPUs,
+			Reserved:  reservedCPUs,
+		}
+	}
+
+	if countSet(machineFile, sysfsDir, machineInfoFile, nrtFile) > 1 {
+		fmt.Fprintf(os.Stderr, "--machine, --sysfs, --machine-info and --nrt are mutually exclusive\n")
+		os.Exit(exitInputError)
+	}
+	if machineFile != "" {
+		params.Machine, err = machine.Load(machineFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading the machine topology from %q: %v\n", machineFile, err)
+			os.Exit(exitInputError)
+		}
+	}
+	if sysfsDir != "" {
+		params.Machine, err = machine.FromSysfs(sysfsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error importing the machine topology from %q: %v\n", sysfsDir, err)
+			os.Exit(exitInputError)
+		}
+	}
+	if machineInfoFile != "" {
+		params.Machine, err = machine.LoadMachineInfo(machineInfoFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error importing the machine topology from %q: %v\n", machineInfoFile, err)
+			os.Exit(exitInputError)
+		}
+	}
+	if nrtFile != "" {
+		params.Machine, err = machine.LoadNRT(nrtFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error importing the machine topology from %q: %v\n", nrtFile, err)
+			os.Exit(exitInputError)
+		}
+	}
+	if params.Machine != nil && !pflag.CommandLine.Changed("numa") {
+		params.NUMANodes = nil
+	}
+	if params.Machine != nil && params.Machine.Policy != "" && !pflag.CommandLine.Changed("policy") {
+		params.PolicyName = params.Machine.Policy
+	}
+	if params.Machine != nil && params.Machine.Scope != "" && !pflag.CommandLine.Changed("scope") {
+		params.ScopeName = params.Machine.Scope
+	}
+	if dumpMachine {
+		os.Exit(printMachine(params.Machine))
+	}
+
+	policies, err := tmpolx.ParsePolicies(params.PolicyName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(exitInputError)
+	}
+	if len(policies) > 1 {
+		if kubeletLog != "" || podFile != "" || useManager || explain || numaMap {
+			fmt.Fprintf(os.Stderr, "comparing policies is not supported with --kubelet-log, --pod, --manager, --explain and --map\n")
+			os.Exit(exitInputError)
+		}
+		os.Exit(comparePolicies(params, policies, outputFormat))
+	}
+
+	if podFile != "" {
+		os.Exit(admitPod(podFile, params, outputFormat))
+	}
+	if kubeletLog != "" && verify {
+		os.Exit(verifyKubeletLog(kubeletLog, params, quiet))
+	}
+	if kubeletLog != "" {
+		os.Exit(runKubeletLog(kubeletLog, params, quiet))
 	}
 
 	tmpx, err := tmpolx.NewFromParams(params)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error creating TMPolx object: %v\n", err)
-		os.Exit(2)
+		os.Exit(exitInputError)
+	}
+
+	if outputFormat == tmpolx.OutputText {
+		printWarnings(tmpx)
+		printTable(tmpx, quiet)
+	}
+	if useManager {
+		podRes, err := tmpx.AdmitWithManager()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error admitting through the topology manager: %v\n", err)
+			if errors.Is(err, tmpolx.ErrManagerDiverges) {
+				os.Exit(exitInternalError)
+			}
+			os.Exit(exitInputError)
+		}
+		os.Exit(printPodResult(podRes, outputFormat))
+	}
+
+	res := tmpx.Run()
+	if explain {
+		exp, err := tmpx.Explain()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error explaining the result: %v\n", err)
+			os.Exit(exitInternalError)
+		}
+		// keep the structured output parseable
+		dst := os.Stdout
+		if outputFormat != tmpolx.OutputText {
+			dst = os.Stderr
+		}
+		fmt.Fprintf(dst, "%s", exp.String())
+	}
+	if numaMap {
+		// keep the structured output parseable
+		dst := os.Stdout
+		if outputFormat != tmpolx.OutputText {
+			dst = os.Stderr
+		}
+		fmt.Fprintf(dst, "%s", tmpx.RenderMap(res.Hint))
+	}
+	out, err := res.Render(outputFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error rendering the result: %v\n", err)
+		os.Exit(exitInternalError)
+	}
+	fmt.Printf("%s", out)
+	if !res.Admit {
+		os.Exit(exitRejected)
+	}
+}
+
+// comparePolicies exits with exitRejected if any compared policy rejects the hints,
+// so exitAdmitted means every compared policy admits them
+func comparePolicies(params tmpolx.Params, policies []string, outputFormat string) int {
+	cmp, err := tmpolx.Compare(params, policies)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating TMPolx object: %v\n", err)
+		return exitInputError
+	}
+	out, err := cmp.Render(outputFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error rendering the comparison: %v\n", err)
+		return exitInternalError
 	}
+	fmt.Printf("%s", out)
+	for _, res := range cmp.Results {
+		if !res.Admit {
+			return exitRejected
+		}
+	}
+	return exitAdmitted
+}
 
+func admitPod(podFile string, params tmpolx.Params, outputFormat string) int {
+	pd, err := pod.Load(podFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading the pod from %q: %v\n", podFile, err)
+		return exitInputError
+	}
+	res, err := tmpolx.AdmitPod(params, pd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error admitting the pod: %v\n", err)
+		return exitInputError
+	}
+	return printPodResult(res, outputFormat)
+}
+
+func printPodResult(res tmpolx.PodResult, outputFormat string) int {
+	if outputFormat == tmpolx.OutputText {
+		for _, warning := range res.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+	}
+	out, err := res.Render(outputFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error rendering the result: %v\n", err)
+		return exitInternalError
+	}
+	fmt.Printf("%s", out)
+	if !res.Admit {
+		return exitRejected
+	}
+	return exitAdmitted
+}
+
+func countSet(values ...string) int {
+	count := 0
+	for _, value := range values {
+		if value != "" {
+			count++
+		}
+	}
+	return count
+}
+
+func printTable(tmpx *tmpolx.TMPolx, quiet bool) {
+	if quiet {
+		return
+	}
 	fmt.Fprintf(os.Stderr, "%s", tmpx.String())
+}
+
+func printWarnings(tmpx *tmpolx.TMPolx) {
+	for _, warning := range tmpx.GetWarnings() {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+}
+
+func runScenarios(scenarioFile string, quiet bool) int {
+	scenarios, err := scenario.Load(scenarioFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading scenarios from %q: %v\n", scenarioFile, err)
+		return exitInputError
+	}
+
+	failed := 0
+	for _, sc := range scenarios {
+		tmpx, err := sc.NewTMPolx()
+		if err != nil {
+			failed++
+			fmt.Println(sc.Broken(err).String())
+			continue
+		}
 
-	bestHint, admit := tmpx.Run()
-	fmt.Printf("admit=%v hint=%v\n", admit, bestHint)
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "running scenario %q\n", sc.Name)
+		}
+		printWarnings(tmpx)
+		printTable(tmpx, quiet)
+
+		bestHint, admit := tmpx.Merge()
+		res := sc.Check(bestHint, admit)
+		if !res.Passed() {
+			failed++
+		}
+		fmt.Println(res.String())
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d/%d scenarios failed\n", failed, len(scenarios))
+		return exitCheckFailed
+	}
+	return exitAdmitted
+}
+
+func readKubeletLog(kubeletLog string) ([]kubeletlog.Admission, error) {
+	if kubeletLog == "-" {
+		return kubeletlog.Parse(os.Stdin)
+	}
+	src, err := os.Open(kubeletLog)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return kubeletlog.Parse(src)
+}
+
+func runKubeletLog(kubeletLog string, params tmpolx.Params, quiet bool) int {
+	admissions, err := readKubeletLog(kubeletLog)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading the kubelet log %q: %v\n", kubeletLog, err)
+		return exitInputError
+	}
+
+	ret := exitAdmitted
+	for _, adm := range admissions {
+		tmpx, err := tmpolx.NewFromParams(adm.ToParams(params))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating TMPolx object: %v\n", err)
+			return exitInputError
+		}
+
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "admission at line %d, %s scope: %s\n", adm.Line, adm.Scope, adm.String())
+		}
+		printWarnings(tmpx)
+		printTable(tmpx, quiet)
+
+		res := tmpx.Run()
+		fmt.Printf("%s %s\n", adm.String(), res.String())
+		if !res.Admit {
+			ret = exitRejected
+		}
+	}
+	return ret
+}
+
+func verifyKubeletLog(kubeletLog string, params tmpolx.Params, quiet bool) int {
+	admissions, err := readKubeletLog(kubeletLog)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading the kubelet log %q: %v\n", kubeletLog, err)
+		return exitInputError
+	}
+
+	verified, mismatches, failures := 0, 0, 0
+	for _, adm := range admissions {
+		vr := kubeletlog.Verify(adm, params)
+		fmt.Println(vr.String())
+		if vr.Error != nil {
+			failures++
+			continue
+		}
+		if !vr.Verified() {
+			continue
+		}
+		verified++
+		if !vr.Matches() {
+			mismatches++
+			if !quiet {
+				fmt.Printf("%s", vr.TMPolx.String())
+			}
+		}
+	}
+
+	fmt.Printf("%d admissions verified, %d mismatches", verified, mismatches)
+	if failures > 0 {
+		fmt.Printf(", %d errors", failures)
+	}
+	fmt.Println()
+	if failures > 0 {
+		return exitInputError
+	}
+	if mismatches > 0 {
+		return exitCheckFailed
+	}
+	return exitAdmitted
+}
+
+func printMachine(mach *machine.Machine) int {
+	if mach == nil {
+		fmt.Fprintf(os.Stderr, "missing machine topology\n")
+		return exitInputError
+	}
+	data, err := yaml.Marshal(mach)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error rendering the machine topology: %v\n", err)
+		return exitInternalError
+	}
+	fmt.Printf("%s", data)
+	return exitAdmitted
 }
@@ -3,10 +3,13 @@ module github.com/fromanirh/tmpolx
 go 1.18
 
 require (
-	github.com/fromanirh/cpumgrx v0.0.12
+	github.com/google/cadvisor v0.45.0
 	github.com/spf13/pflag v1.0.5
+	k8s.io/api v0.25.3
+	k8s.io/apimachinery v0.25.3
 	k8s.io/klog/v2 v2.70.1
 	k8s.io/kubernetes v1.25.3
+	sigs.k8s.io/yaml v1.2.0
 )
 
 require (
@@ -27,7 +30,6 @@ require (
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/google/cadvisor v0.45.0 // indirect
 	github.com/google/gnostic v0.5.7-v3refs // indirect
 	github.com/google/go-cmp v0.5.8 // indirect
 	github.com/google/gofuzz v1.1.0 // indirect
@@ -62,8 +64,6 @@ require (
 	gopkg.in/inf.v0 v0.9.1 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	k8s.io/api v0.25.3 // indirect
-	k8s.io/apimachinery v0.25.3 // indirect
 	k8s.io/apiserver v0.25.3 // indirect
 	k8s.io/client-go v0.25.3 // indirect
 	k8s.io/cloud-provider v0.25.3 // indirect
@@ -77,7 +77,6 @@ require (
 	k8s.io/utils v0.0.0-20220728103510-ee6ede2d64ed // indirect
 	sigs.k8s.io/json v0.0.0-20220713155537-f223a00ba0e2 // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.2.3 // indirect
-	sigs.k8s.io/yaml v1.2.0 // indirect
 )
 
 // Pinned to kubernetes-1.25.3
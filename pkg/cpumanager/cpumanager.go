@@ -0,0 +1,196 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package cpumanager
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+	"github.com/fromanirh/tmpolx/pkg/machine"
+)
+
+/*
+GenerateHints generates the cpu hints like the static CPU manager policy does (see generateCPUTopologyHints
+in the kubelet sources): every NUMA node mask with enough available CPUs to satisfy the request becomes a hint,
+preferred if it has the minimum number of NUMA nodes whose CPUs, available or not, could satisfy the request.
+Like the static policy, which only knows the NUMA nodes of its CPUs, the NUMA nodes without CPUs (like the
+memory-only nodes of CXL or HBM memory) are left out of the masks.
+The CPUs reused from the init containers and the CPUs already allocated to the container are not considered.
+If the machine topology has no cpu ids, like the ones imported from NodeResourceTopology objects, the hints are
+generated out of the cpu capacity and the available cpus of each NUMA node, which reflect the node state.
+*/
+
+const (
+	// ProviderName is the name the kubelet logs the CPU manager hints with
+	ProviderName = "cpumanager"
+	// ResourceName is the only resource the CPU manager reports hints for
+	ResourceName = "cpu"
+)
+
+// Request is an exclusive CPUs request of a guaranteed container
+type Request struct {
+	CPUs int `json:"cpus"`
+	// Available are the CPUs in the shared pool; all the machine CPUs if empty
+	Available string `json:"available,omitempty"`
+	// Reserved are the CPUs reserved for the system, never available for exclusive allocation
+	Reserved string `json:"reserved,omitempty"`
+}
+
+// availableCPUs returns the CPUs available for exclusive allocation, like the static policy GetAvailableCPUs
+func (req Request) availableCPUs(allCPUs cpuset.CPUSet) (cpuset.CPUSet, error) {
+	available := allCPUs
+	if req.Available != "" {
+		var err error
+		available, err = cpuset.Parse(req.Available)
+		if err != nil {
+			return available, fmt.Errorf("bad format for available cpus: %w", err)
+		}
+		if !available.IsSubsetOf(allCPUs) {
+			return available, fmt.Errorf("available cpus %v are not machine cpus", available.Difference(allCPUs))
+		}
+	}
+	reserved, err := cpuset.Parse(req.Reserved)
+	if err != nil {
+		return available, fmt.Errorf("bad format for reserved cpus: %w", err)
+	}
+	if !reserved.IsSubsetOf(allCPUs) {
+		return available, fmt.Errorf("reserved cpus %v are not machine cpus", reserved.Difference(allCPUs))
+	}
+	return available.Difference(reserved), nil
+}
+
+// cpuCount is how many cpus a NUMA node has, and how many of them are available for exclusive allocation
+type cpuCount struct {
+	total     int
+	available int
+}
+
+// countCPUs counts the cpus of each NUMA node. If the machine topology has no cpu ids, like the ones imported
+// from NodeResourceTopology objects, the cpu capacity and the available cpus of the NUMA nodes are used instead.
+func countCPUs(mach *machine.Machine, req Request) (map[int]cpuCount, error) {
+	counts := make(map[int]cpuCount)
+	nodeCPUs := make(map[int]cpuset.CPUSet)
+	allCPUs := cpuset.NewCPUSet()
+	for _, node := range mach.NodeIDs() {
+		cpus, err := mach.NodeCPUs(node)
+		if err != nil {
+			return nil, err
+		}
+		nodeCPUs[node] = cpus
+		allCPUs = allCPUs.Union(cpus)
+	}
+	if allCPUs.IsEmpty() {
+		return countNodeResourceCPUs(mach, req)
+	}
+	available, err := req.availableCPUs(allCPUs)
+	if err != nil {
+		return nil, err
+	}
+	for node, cpus := range nodeCPUs {
+		counts[node] = cpuCount{
+			total:     cpus.Size(),
+			available: cpus.Intersection(available).Size(),
+		}
+	}
+	return counts, nil
+}
+
+func countNodeResourceCPUs(mach *machine.Machine, req Request) (map[int]cpuCount, error) {
+	counts := make(map[int]cpuCount)
+	found := false
+	for _, node := range mach.NUMANodes {
+		for _, res := range node.Resources {
+			if res.Name != ResourceName {
+				continue
+			}
+			counts[node.ID] = cpuCount{
+				total:     int(res.Capacity.Value()),
+				available: int(res.Available.Value()),
+			}
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("the machine topology has no cpus")
+	}
+	if req.Available != "" || req.Reserved != "" {
+		return nil, fmt.Errorf("the machine topology has only the cpu counts: available and reserved cpus can't be set")
+	}
+	return counts, nil
+}
+
+func GenerateHints(mach *machine.Machine, req Request) ([]topologymanager.TopologyHint, error) {
+	if req.CPUs <= 0 {
+		return nil, fmt.Errorf("invalid cpu request: %d", req.CPUs)
+	}
+	counts, err := countCPUs(mach, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// like the CPUDetails.NUMANodes() of the static policy
+	var nodeIDs []int
+	for _, node := range mach.NodeIDs() {
+		if counts[node].total > 0 {
+			nodeIDs = append(nodeIDs, node)
+		}
+	}
+	minAffinitySize := len(nodeIDs)
+	hints := []topologymanager.TopologyHint{}
+	bitmask.IterateBitMasks(nodeIDs, func(mask bitmask.BitMask) {
+		// the cpus of different NUMA nodes are disjoint
+		var inMask cpuCount
+		for _, node := range mask.GetBits() {
+			inMask.total += counts[node].total
+			inMask.available += counts[node].available
+		}
+		if inMask.total >= req.CPUs && mask.Count() < minAffinitySize {
+			minAffinitySize = mask.Count()
+		}
+		if inMask.available < req.CPUs {
+			return
+		}
+		hints = append(hints, topologymanager.TopologyHint{
+			NUMANodeAffinity: mask,
+			Preferred:        false,
+		})
+	})
+
+	for idx := range hints {
+		if hints[idx].NUMANodeAffinity.Count() == minAffinitySize {
+			hints[idx].Preferred = true
+		}
+	}
+	return hints, nil
+}
+
+// ProviderHints returns the generated hints as reported by the CPU manager
+func ProviderHints(mach *machine.Machine, req Request) (tmhints.ProviderHints, error) {
+	hints, err := GenerateHints(mach, req)
+	if err != nil {
+		return tmhints.ProviderHints{}, err
+	}
+	return tmhints.ProviderHints{
+		Name:      ProviderName,
+		Hints:     map[string][]topologymanager.TopologyHint{ResourceName: hints},
+		Resources: []string{ResourceName},
+	}, nil
+}
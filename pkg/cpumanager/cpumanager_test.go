@@ -0,0 +1,180 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package cpumanager
+
+import (
+	"testing"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+	"github.com/fromanirh/tmpolx/pkg/machine"
+)
+
+// two NUMA nodes with 4 cpus each, and a memory-only NUMA node
+const testMachine = `
+numaNodes:
+- id: 0
+  cpus: "0-3"
+- id: 1
+  cpus: "4-7"
+- id: 2
+`
+
+func TestGenerateHints(t *testing.T) {
+	mach, err := machine.Parse([]byte(testMachine))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type testCase struct {
+		name     string
+		req      Request
+		expected string
+	}
+
+	testCases := []testCase{
+		{
+			// the narrowest masks are preferred; the memory-only node is not in the masks
+			name:     "fits a single NUMA node",
+			req:      Request{CPUs: 2},
+			expected: "[{nodes=0 true} {nodes=1 true} {nodes=0-1 false}]",
+		},
+		{
+			name:     "needs two NUMA nodes",
+			req:      Request{CPUs: 6},
+			expected: "[{nodes=0-1 true}]",
+		},
+		{
+			name:     "needs all the cpus",
+			req:      Request{CPUs: 8},
+			expected: "[{nodes=0-1 true}]",
+		},
+		{
+			name:     "reserved cpus are not available",
+			req:      Request{CPUs: 2, Reserved: "0-1"},
+			expected: "[{nodes=0 true} {nodes=1 true} {nodes=0-1 false}]",
+		},
+		{
+			// the minimum affinity size comes from all the cpus, so no hint is preferred
+			// if the cpus available on a single NUMA node are not enough
+			name:     "not enough available cpus on a single NUMA node",
+			req:      Request{CPUs: 3, Available: "2-5"},
+			expected: "[{nodes=0-1 false}]",
+		},
+		{
+			name:     "reserved and available cpus",
+			req:      Request{CPUs: 3, Available: "1-7", Reserved: "1"},
+			expected: "[{nodes=1 true} {nodes=0-1 false}]",
+		},
+		{
+			name:     "not enough available cpus",
+			req:      Request{CPUs: 4, Available: "4-7", Reserved: "6-7"},
+			expected: "[]",
+		},
+		{
+			name:     "more cpus than the machine has",
+			req:      Request{CPUs: 9},
+			expected: "[]",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hints, err := GenerateHints(mach, tc.req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if hints == nil {
+				t.Fatalf("expected empty hints, got nil")
+			}
+			got := tmhints.FormatHints(hints, tmhints.MaskFormatList)
+			if got != tc.expected {
+				t.Errorf("got %s expected %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateHintsErrors(t *testing.T) {
+	mach, err := machine.Parse([]byte(testMachine))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	noCPUs, err := machine.Parse([]byte("numaNodes:\n- id: 0\n- id: 1\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type testCase struct {
+		name string
+		mach *machine.Machine
+		req  Request
+	}
+
+	testCases := []testCase{
+		{name: "no cpus requested", mach: mach, req: Request{CPUs: 0}},
+		{name: "bad available cpus", mach: mach, req: Request{CPUs: 1, Available: "0-"}},
+		{name: "available cpus not in the machine", mach: mach, req: Request{CPUs: 1, Available: "6-9"}},
+		{name: "reserved cpus not in the machine", mach: mach, req: Request{CPUs: 1, Reserved: "8"}},
+		{name: "machine with no cpus", mach: noCPUs, req: Request{CPUs: 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if hints, err := GenerateHints(tc.mach, tc.req); err == nil {
+				t.Errorf("expected error, got %v", hints)
+			}
+		})
+	}
+}
+
+func TestGenerateHintsFromNodeResources(t *testing.T) {
+	mach, err := machine.LoadNRT("../../examples/nrt.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type testCase struct {
+		name     string
+		cpus     int
+		expected string
+	}
+
+	// NUMA node 0 has 8 cpus, 2 available; NUMA node 1 has 8 cpus, all available
+	testCases := []testCase{
+		{name: "fits both NUMA nodes", cpus: 2, expected: "[{nodes=0 true} {nodes=1 true} {nodes=0-1 false}]"},
+		{name: "fits only the NUMA node 1", cpus: 4, expected: "[{nodes=1 true} {nodes=0-1 false}]"},
+		{name: "needs both NUMA nodes", cpus: 10, expected: "[{nodes=0-1 true}]"},
+		{name: "not enough available cpus", cpus: 12, expected: "[]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hints, err := GenerateHints(mach, Request{CPUs: tc.cpus})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := tmhints.FormatHints(hints, tmhints.MaskFormatList)
+			if got != tc.expected {
+				t.Errorf("got %s expected %s", got, tc.expected)
+			}
+		})
+	}
+
+	if hints, err := GenerateHints(mach, Request{CPUs: 2, Reserved: "0"}); err == nil {
+		t.Errorf("expected error setting the reserved cpus, got %v", hints)
+	}
+}
@@ -0,0 +1,375 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package hints
+
+import (
+	"fmt"
+)
+
+/*
+The go format is what the kubelet emits when it logs the hints, e.g.
+
+	cpu:[{01 true} {10 true} {11 false}]
+
+Hints copied from structured log lines carry the field names, which are accepted too:
+
+	cpu:[{NUMANodeAffinity:01 Preferred:true} {NUMANodeAffinity:11 Preferred:false}]
+
+Masks can also be written as hex numbers or NUMA node lists (see ParseMask):
+
+	cpu:[{0x1 true} {nodes=0,1 false}]
+
+A provider with no preference for a resource reports a nil hint list, while a provider
+which cannot satisfy the resource reports an empty one. These are expressed as
+
+	cpu:<nil>
+	cpu:[]
+
+Hints can be prefixed with the name of the hint provider which reported them.
+A provider which reported no hints at all (empty map) is expressed as
+
+	devicemanager:nvidia.com/gpu:[{01 true} {11 false}]
+	devicemanager:map[]
+*/
+
+const (
+	labelMask      = "NUMANodeAffinity"
+	labelPreferred = "Preferred"
+
+	nilHints = "<nil>"
+	emptyMap = "map"
+)
+
+// SyntaxError reports a malformed hint argument. Arg is the one-based position of the
+// argument, Column the one-based byte offset of the offending token inside it.
+type SyntaxError struct {
+	Arg      int
+	Input    string
+	Column   int
+	Expected string
+	Found    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("hint argument #%d %q, column %d: expected %s, found %s", e.Arg, e.Input, e.Column, e.Expected, e.Found)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokColon
+	tokLBracket
+	tokRBracket
+	tokLBrace
+	tokRBrace
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	col  int
+}
+
+func (tok token) describe() string {
+	if tok.kind == tokEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", tok.text)
+}
+
+var delimiters = map[byte]tokenKind{
+	':': tokColon,
+	'[': tokLBracket,
+	']': tokRBracket,
+	'{': tokLBrace,
+	'}': tokRBrace,
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func tokenize(s string) []token {
+	var tokens []token
+	idx := 0
+	for idx < len(s) {
+		c := s[idx]
+		if isSpace(c) {
+			idx++
+			continue
+		}
+		if kind, ok := delimiters[c]; ok {
+			tokens = append(tokens, token{kind: kind, text: string(c), col: idx + 1})
+			idx++
+			continue
+		}
+		start := idx
+		for idx < len(s) {
+			if _, ok := delimiters[s[idx]]; ok || isSpace(s[idx]) {
+				break
+			}
+			idx++
+		}
+		tokens = append(tokens, token{kind: tokWord, text: s[start:idx], col: start + 1})
+	}
+	return append(tokens, token{kind: tokEOF, col: len(s) + 1})
+}
+
+type parser struct {
+	arg    int
+	input  string
+	tokens []token
+	pos    int
+}
+
+func newParser(arg int, input string) *parser {
+	return &parser{
+		arg:    arg,
+		input:  input,
+		tokens: tokenize(input),
+	}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorAt(col int, expected, found string) error {
+	return &SyntaxError{
+		Arg:      p.arg,
+		Input:    p.input,
+		Column:   col,
+		Expected: expected,
+		Found:    found,
+	}
+}
+
+func (p *parser) expect(kind tokenKind, expected string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, p.errorAt(tok.col, expected, tok.describe())
+	}
+	return tok, nil
+}
+
+// [provider:]resource:[{mask preferred} ...] | [provider:]resource:<nil> | provider:map[]
+func (p *parser) parseResHints() (ResHints, error) {
+	var rh ResHints
+	tok, err := p.expect(tokWord, "resource or provider name")
+	if err != nil {
+		return rh, err
+	}
+	rh.Resource = tok.text
+	if _, err := p.expect(tokColon, `":"`); err != nil {
+		return rh, err
+	}
+
+	if tok := p.peek(); tok.kind == tokWord && tok.text != nilHints {
+		rh.Provider = rh.Resource
+		rh.Resource = ""
+		if tok.text == emptyMap && p.peekAt(1).kind == tokLBracket {
+			p.next()
+			p.next()
+			if _, err := p.expect(tokRBracket, `"]"`); err != nil {
+				return rh, err
+			}
+			if _, err := p.expect(tokEOF, "end of input"); err != nil {
+				return rh, err
+			}
+			return rh, nil
+		}
+		p.next()
+		rh.Resource = tok.text
+		if _, err := p.expect(tokColon, `":"`); err != nil {
+			return rh, err
+		}
+	}
+
+	if tok := p.peek(); tok.kind == tokWord && tok.text == nilHints {
+		p.next()
+	} else {
+		rh.Hints, err = p.parseHintList()
+		if err != nil {
+			return rh, err
+		}
+	}
+	if _, err := p.expect(tokEOF, "end of input"); err != nil {
+		return rh, err
+	}
+	return rh, nil
+}
+
+func (p *parser) parseHintList() ([]Hint, error) {
+	if _, err := p.expect(tokLBracket, `"[" or "<nil>"`); err != nil {
+		return nil, err
+	}
+	hints := []Hint{}
+	for p.peek().kind != tokRBracket {
+		if p.peek().kind != tokLBrace {
+			tok := p.next()
+			return nil, p.errorAt(tok.col, `"{" or "]"`, tok.describe())
+		}
+		ht, err := p.parseHint()
+		if err != nil {
+			return nil, err
+		}
+		hints = append(hints, ht)
+	}
+	p.next()
+	return hints, nil
+}
+
+func (p *parser) parseHint() (Hint, error) {
+	var ht Hint
+	if _, err := p.expect(tokLBrace, `"{"`); err != nil {
+		return ht, err
+	}
+
+	if err := p.skipLabel(labelMask); err != nil {
+		return ht, err
+	}
+	tok, err := p.expect(tokWord, "NUMA affinity mask")
+	if err != nil {
+		return ht, err
+	}
+	if tok.text != nilHints {
+		if _, err := ParseMask(tok.text); err != nil {
+			return ht, p.errorAt(tok.col, "NUMA affinity mask (binary, hex or node list)", fmt.Sprintf("%q (%v)", tok.text, err))
+		}
+	}
+	ht.Mask = tok.text
+
+	if err := p.skipLabel(labelPreferred); err != nil {
+		return ht, err
+	}
+	tok, err = p.expect(tokWord, "preferred flag (true|false)")
+	if err != nil {
+		return ht, err
+	}
+	switch tok.text {
+	case "true":
+		ht.Preferred = true
+	case "false":
+		ht.Preferred = false
+	default:
+		return ht, p.errorAt(tok.col, "preferred flag (true|false)", tok.describe())
+	}
+
+	if _, err := p.expect(tokRBrace, `"}"`); err != nil {
+		return ht, err
+	}
+	return ht, nil
+}
+
+// skipLabel consumes the optional "Label:" prefix of a hint field.
+func (p *parser) skipLabel(label string) error {
+	tok := p.peek()
+	if tok.kind != tokWord || p.peekAt(1).kind != tokColon {
+		return nil
+	}
+	if tok.text != label {
+		return p.errorAt(tok.col, fmt.Sprintf("%q", label), tok.describe())
+	}
+	p.next()
+	p.next()
+	return nil
+}
+
+func ParseGOResHints(arg int, rawHint string) (ResHints, error) {
+	return newParser(arg, rawHint).parseResHints()
+}
+
+// map[cpu:[{01 true} {10 true}] memory:[]], as the kubelet logs the hints of a provider
+func ParseGOMap(arg int, rawHints string) ([]ResHints, error) {
+	p := newParser(arg, rawHints)
+	var rhs []ResHints
+	tok := p.next()
+	if tok.kind != tokWord || tok.text != emptyMap {
+		return nil, p.errorAt(tok.col, `"map"`, tok.describe())
+	}
+	if _, err := p.expect(tokLBracket, `"["`); err != nil {
+		return nil, err
+	}
+	for p.peek().kind != tokRBracket {
+		tok, err := p.expect(tokWord, `resource name or "]"`)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokColon, `":"`); err != nil {
+			return nil, err
+		}
+		hints, err := p.parseHintList()
+		if err != nil {
+			return nil, err
+		}
+		rhs = append(rhs, ResHints{
+			Resource: tok.text,
+			Hints:    hints,
+		})
+	}
+	p.next()
+	if _, err := p.expect(tokEOF, "end of input"); err != nil {
+		return nil, err
+	}
+	return rhs, nil
+}
+
+// {01 true}
+func ParseGOHint(arg int, rawHint string) (Hint, error) {
+	p := newParser(arg, rawHint)
+	ht, err := p.parseHint()
+	if err != nil {
+		return ht, err
+	}
+	if _, err := p.expect(tokEOF, "end of input"); err != nil {
+		return ht, err
+	}
+	return ht, nil
+}
+
+// cpu:[{01 true} {10 true} {11 false}]
+func ParseGO(rawHints []string) ([]ProviderHints, error) {
+	var allHints []ProviderHints
+	for idx, rawHint := range rawHints {
+		rh, err := ParseGOResHints(idx+1, rawHint)
+		if err != nil {
+			return allHints, err
+		}
+		allHints, err = addHints(allHints, rh)
+		if err != nil {
+			return allHints, err
+		}
+	}
+	return allHints, nil
+}
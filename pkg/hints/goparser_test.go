@@ -0,0 +1,292 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package hints
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseGOResHints(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected ResHints
+		// if errColumn is not zero, the parse must fail at that column
+		errColumn int
+		errFound  string
+	}
+
+	testCases := []testCase{
+		{
+			name:  "single hint",
+			input: "cpu:[{01 true}]",
+			expected: ResHints{
+				Resource: "cpu",
+				Hints:    []Hint{{Mask: "01", Preferred: true}},
+			},
+		},
+		{
+			name:  "many hints",
+			input: "cpu:[{01 true} {10 true} {11 false}]",
+			expected: ResHints{
+				Resource: "cpu",
+				Hints: []Hint{
+					{Mask: "01", Preferred: true},
+					{Mask: "10", Preferred: true},
+					{Mask: "11", Preferred: false},
+				},
+			},
+		},
+		{
+			name:  "field names",
+			input: "cpu:[{NUMANodeAffinity:01 Preferred:true} {NUMANodeAffinity:11 Preferred:false}]",
+			expected: ResHints{
+				Resource: "cpu",
+				Hints: []Hint{
+					{Mask: "01", Preferred: true},
+					{Mask: "11", Preferred: false},
+				},
+			},
+		},
+		{
+			name:  "extra spaces",
+			input: " cpu : [ { 01  true }  ] ",
+			expected: ResHints{
+				Resource: "cpu",
+				Hints:    []Hint{{Mask: "01", Preferred: true}},
+			},
+		},
+		{
+			name:  "nil hints",
+			input: "cpu:<nil>",
+			expected: ResHints{
+				Resource: "cpu",
+			},
+		},
+		{
+			name:  "empty hints",
+			input: "cpu:[]",
+			expected: ResHints{
+				Resource: "cpu",
+				Hints:    []Hint{},
+			},
+		},
+		{
+			name:  "nil mask",
+			input: "cpu:[{<nil> false}]",
+			expected: ResHints{
+				Resource: "cpu",
+				Hints:    []Hint{{Mask: "<nil>", Preferred: false}},
+			},
+		},
+		{
+			name:  "provider",
+			input: "devicemanager:nvidia.com/gpu:[{01 true} {11 false}]",
+			expected: ResHints{
+				Provider: "devicemanager",
+				Resource: "nvidia.com/gpu",
+				Hints: []Hint{
+					{Mask: "01", Preferred: true},
+					{Mask: "11", Preferred: false},
+				},
+			},
+		},
+		{
+			name:  "provider with nil hints",
+			input: "cpumanager:cpu:<nil>",
+			expected: ResHints{
+				Provider: "cpumanager",
+				Resource: "cpu",
+			},
+		},
+		{
+			name:  "provider with no hints",
+			input: "devicemanager:map[]",
+			expected: ResHints{
+				Provider: "devicemanager",
+			},
+		},
+		{
+			name:      "empty input",
+			input:     "",
+			errColumn: 1,
+			errFound:  "end of input",
+		},
+		{
+			name:      "missing colon",
+			input:     "cpu[{01 true}]",
+			errColumn: 4,
+			errFound:  `"["`,
+		},
+		{
+			name:      "bare hint",
+			input:     "{01}",
+			errColumn: 1,
+			errFound:  `"{"`,
+		},
+		{
+			name:      "missing hint list",
+			input:     "cpu:{01 true}",
+			errColumn: 5,
+			errFound:  `"{"`,
+		},
+		{
+			name:      "missing preferred flag",
+			input:     "cpu:[{01}]",
+			errColumn: 9,
+			errFound:  `"}"`,
+		},
+		{
+			name:      "bad preferred flag",
+			input:     "cpu:[{01 yes}]",
+			errColumn: 10,
+			errFound:  `"yes"`,
+		},
+		{
+			name:      "capitalized preferred flag",
+			input:     "cpu:[{01 True}]",
+			errColumn: 10,
+			errFound:  `"True"`,
+		},
+		{
+			name:      "wrong field name",
+			input:     "cpu:[{Preferred:01 true}]",
+			errColumn: 7,
+			errFound:  `"Preferred"`,
+		},
+		{
+			name:      "unterminated hint list",
+			input:     "cpu:[{01 true}",
+			errColumn: 15,
+			errFound:  "end of input",
+		},
+		{
+			name:      "trailing garbage",
+			input:     "cpu:[{01 true}] x",
+			errColumn: 17,
+			errFound:  `"x"`,
+		},
+		{
+			name:      "trailing bracket",
+			input:     "cpu:[{01 true}]]",
+			errColumn: 16,
+			errFound:  `"]"`,
+		},
+		{
+			name:      "nil inside the hint list",
+			input:     "cpu:[<nil>]",
+			errColumn: 6,
+			errFound:  `"<nil>"`,
+		},
+		{
+			name:      "trailing garbage after nil",
+			input:     "cpu:<nil> x",
+			errColumn: 11,
+			errFound:  `"x"`,
+		},
+		{
+			name:      "provider with missing hint list",
+			input:     "provider:resource:",
+			errColumn: 19,
+			errFound:  "end of input",
+		},
+		{
+			name:      "too many names",
+			input:     "a:b:c:[]",
+			errColumn: 5,
+			errFound:  `"c"`,
+		},
+		{
+			name:      "provider with resources in the map",
+			input:     "devicemanager:map[cpu]",
+			errColumn: 19,
+			errFound:  `"cpu"`,
+		},
+		{
+			name:      "trailing garbage after the empty map",
+			input:     "devicemanager:map[] x",
+			errColumn: 21,
+			errFound:  `"x"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rh, err := ParseGOResHints(1, tc.input)
+			if tc.errColumn == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(rh, tc.expected) {
+					t.Fatalf("got %#v expected %#v", rh, tc.expected)
+				}
+				return
+			}
+			var synErr *SyntaxError
+			if !errors.As(err, &synErr) {
+				t.Fatalf("expected a syntax error, got %v", err)
+			}
+			if synErr.Arg != 1 || synErr.Input != tc.input {
+				t.Errorf("bad argument in %v", synErr)
+			}
+			if synErr.Column != tc.errColumn || synErr.Found != tc.errFound {
+				t.Errorf("got column %d found %s, expected column %d found %s", synErr.Column, synErr.Found, tc.errColumn, tc.errFound)
+			}
+		})
+	}
+}
+
+func TestParseGOArgPosition(t *testing.T) {
+	_, err := ParseGO([]string{"cpu:[{01 true}]", "memory:[{01 maybe}]"})
+	var synErr *SyntaxError
+	if !errors.As(err, &synErr) {
+		t.Fatalf("expected a syntax error, got %v", err)
+	}
+	if synErr.Arg != 2 || synErr.Column != 13 {
+		t.Errorf("got argument #%d column %d, expected argument #2 column 13", synErr.Arg, synErr.Column)
+	}
+}
+
+func TestParseGOGroupsProviders(t *testing.T) {
+	phs, err := ParseGO([]string{
+		"cpumanager:cpu:[{01 true}]",
+		"memory:[{10 true}]",
+		"devicemanager:map[]",
+		"cpumanager:hugepages-1Gi:<nil>",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, ph := range phs {
+		names = append(names, ph.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"cpumanager", DefaultProvider, "devicemanager"}) {
+		t.Fatalf("unexpected providers: %v", names)
+	}
+	if !reflect.DeepEqual(phs[0].Resources, []string{"cpu", "hugepages-1Gi"}) {
+		t.Errorf("unexpected cpumanager resources: %v", phs[0].Resources)
+	}
+	if hts, ok := phs[0].Hints["hugepages-1Gi"]; !ok || hts != nil {
+		t.Errorf("expected nil hints for hugepages-1Gi, got %v", hts)
+	}
+	if len(phs[2].Hints) != 0 {
+		t.Errorf("expected no hints for devicemanager, got %v", phs[2].Hints)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package hints
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+)
+
+// DefaultProvider owns all the hints which don't explicitly name their hint provider.
+const DefaultProvider = "default"
+
+// ResHints are the hints a provider reports for a resource. If Resource is empty,
+// the provider reported no hints at all (empty map).
+type ResHints struct {
+	Provider string `json:"Provider,omitempty"`
+	Resource string `json:"R"`
+	Hints    []Hint `json:"H"`
+}
+
+// ProviderHints are all the hints reported by a hint provider, like the kubelet
+// gets calling GetTopologyHints on the CPU, memory or device manager.
+type ProviderHints struct {
+	Name  string
+	Hints map[string][]topologymanager.TopologyHint
+	// Resources are the names of the resources in Hints, in input order
+	Resources []string
+}
+
+// ResourceNames returns the names of the resources the provider has hints for, either
+// in input order or sorted by name. Resources missing from ph.Resources come last, sorted.
+func (ph ProviderHints) ResourceNames(sorted bool) []string {
+	var names, missing []string
+	seen := make(map[string]bool)
+	for _, name := range ph.Resources {
+		if _, ok := ph.Hints[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	for name := range ph.Hints {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	names = append(names, missing...)
+	if sorted {
+		sort.Strings(names)
+	}
+	return names
+}
+
+// Hint is a topology hint. Mask can be in any of the supported notations (see ParseMask);
+// the special Mask "<nil>" means no NUMA affinity at all.
+type Hint struct {
+	Mask      string `json:"M"`
+	Preferred bool   `json:"P"`
+}
+
+func (ht Hint) ToTM() (topologymanager.TopologyHint, error) {
+	if ht.Mask == nilHints {
+		return topologymanager.TopologyHint{Preferred: ht.Preferred}, nil
+	}
+	mask, err := ParseMask(ht.Mask)
+	if err != nil {
+		return topologymanager.TopologyHint{}, err
+	}
+	return topologymanager.TopologyHint{
+		Preferred:        ht.Preferred,
+		NUMANodeAffinity: mask,
+	}, nil
+}
+
+// ToProvidersHints builds the input of topologymanager.Policy.Merge, one map per provider.
+func ToProvidersHints(phs []ProviderHints) []map[string][]topologymanager.TopologyHint {
+	var providersHints []map[string][]topologymanager.TopologyHint
+	for _, ph := range phs {
+		providersHints = append(providersHints, ph.Hints)
+	}
+	return providersHints
+}
+
+// Collect groups the given hints by provider.
+func Collect(rhs []ResHints) ([]ProviderHints, error) {
+	var err error
+	var allHints []ProviderHints
+	for _, rh := range rhs {
+		allHints, err = addHints(allHints, rh)
+		if err != nil {
+			return allHints, err
+		}
+	}
+	return allHints, nil
+}
+
+// addHints merges the hints of rh into the hints of its provider, keeping nil (no preference)
+// distinct from empty (no possible affinity) like the kubelet providers do.
+// Providers are kept in the same order on which they first appear.
+func addHints(allHints []ProviderHints, rh ResHints) ([]ProviderHints, error) {
+	name := rh.Provider
+	if name == "" {
+		name = DefaultProvider
+	}
+	idx := 0
+	for idx < len(allHints) && allHints[idx].Name != name {
+		idx++
+	}
+	if idx == len(allHints) {
+		allHints = append(allHints, ProviderHints{
+			Name:  name,
+			Hints: make(map[string][]topologymanager.TopologyHint),
+		})
+	}
+	if rh.Resource == "" {
+		return allHints, nil
+	}
+
+	hints, ok := allHints[idx].Hints[rh.Resource]
+	if !ok {
+		allHints[idx].Resources = append(allHints[idx].Resources, rh.Resource)
+	}
+	if hints == nil && rh.Hints != nil {
+		hints = []topologymanager.TopologyHint{}
+	}
+	for _, ht := range rh.Hints {
+		tmht, err := ht.ToTM()
+		if err != nil {
+			return allHints, fmt.Errorf("provider %q resource %q: %w", name, rh.Resource, err)
+		}
+		hints = append(hints, tmht)
+	}
+	allHints[idx].Hints[rh.Resource] = hints
+	return allHints, nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package hints
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// {"R":"cpu", "H":[{"M":"01","P":true},{"M":"10","P":true}]}
+// "H": null (or no "H" at all) means no preference, "H": [] means no possible affinity.
+// {"Provider":"devicemanager", "R":"nvidia.com/gpu", "H":[{"M":"01","P":true}]}
+// {"Provider":"devicemanager"} means the provider reported no hints at all.
+func ParseJSONResHints(arg int, rawHint string) (ResHints, error) {
+	var rh ResHints
+	err := json.Unmarshal([]byte(rawHint), &rh)
+	if err != nil {
+		return rh, fmt.Errorf("hint argument #%d %q: %w", arg, rawHint, err)
+	}
+	if rh.Resource == "" && (rh.Provider == "" || rh.Hints != nil) {
+		return rh, fmt.Errorf("hint argument #%d %q: missing resource name", arg, rawHint)
+	}
+	return rh, nil
+}
+
+func ParseJSON(rawHints []string) ([]ProviderHints, error) {
+	var allHints []ProviderHints
+	for idx, rawHint := range rawHints {
+		rh, err := ParseJSONResHints(idx+1, rawHint)
+		if err != nil {
+			return allHints, err
+		}
+		allHints, err = addHints(allHints, rh)
+		if err != nil {
+			return allHints, err
+		}
+	}
+	return allHints, nil
+}
@@ -0,0 +1,174 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package hints
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
+)
+
+/*
+NUMA affinity masks can be expressed as
+- right-aligned binary strings, like the kubelet logs them: 0101, or 0b0101
+- hex numbers: 0x05
+- NUMA node lists, in cpuset syntax, after the nodes= prefix: nodes=0,2 or nodes=4-7
+Strings made only of 0s and 1s are always binary masks, so "10" is NUMA node 1: node lists
+need their prefix, and strings which are neither binary, hex nor prefixed node lists are rejected.
+*/
+
+const (
+	MaskFormatBinary = "binary"
+	MaskFormatHex    = "hex"
+	MaskFormatList   = "list"
+)
+
+// maskPrefixNodes introduces a NUMA node list
+const maskPrefixNodes = "nodes="
+
+func ValidateMaskFormat(format string) error {
+	switch format {
+	case MaskFormatBinary, MaskFormatHex, MaskFormatList:
+		return nil
+	}
+	return fmt.Errorf("unknown mask format: %q", format)
+}
+
+func ParseMask(s string) (bitmask.BitMask, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty mask")
+	}
+	if strings.Trim(s, "01") == "" {
+		return parseBinaryMask(s, s)
+	}
+	if strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B") {
+		if s[2:] == "" || strings.Trim(s[2:], "01") != "" {
+			return nil, fmt.Errorf("invalid binary mask %q", s)
+		}
+		return parseBinaryMask(s, s[2:])
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		val, err := strconv.ParseUint(s[2:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex mask %q: %w", s, err)
+		}
+		mask := bitmask.NewEmptyBitMask()
+		for bit := 0; bit < 64; bit++ {
+			if val&(1<<uint(bit)) != 0 {
+				mask.Add(bit)
+			}
+		}
+		return mask, nil
+	}
+	if !strings.HasPrefix(s, maskPrefixNodes) {
+		return nil, fmt.Errorf("invalid mask %q: NUMA node lists need the %s prefix", s, maskPrefixNodes)
+	}
+	nodes, err := cpuset.Parse(strings.TrimPrefix(s, maskPrefixNodes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid NUMA node list %q: %w", s, err)
+	}
+	mask, err := bitmask.NewBitMask(nodes.ToSlice()...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NUMA node list %q: %w", s, err)
+	}
+	return mask, nil
+}
+
+// parseBinaryMask parses the digits of the given binary mask, rightmost is NUMA node 0
+func parseBinaryMask(s, digits string) (bitmask.BitMask, error) {
+	mask := bitmask.NewEmptyBitMask()
+	num := len(digits)
+	for idx := 0; idx < num; idx++ {
+		if digits[idx] != '1' {
+			continue
+		}
+		if err := mask.Add(num - 1 - idx); err != nil {
+			return nil, fmt.Errorf("invalid mask %q: %w", s, err)
+		}
+	}
+	return mask, nil
+}
+
+// MaskFormatter renders masks in the given Format. Binary masks are left-padded with zeroes
+// to Width digits, so masks can be aligned; the kubelet pads them only to an even width.
+type MaskFormatter struct {
+	Format string
+	Width  int
+}
+
+// NewMaskFormatter returns a formatter which renders all the masks of the given NUMA nodes with the same width
+func NewMaskFormatter(format string, numaNodes []int) MaskFormatter {
+	mf := MaskFormatter{Format: format}
+	if all, err := bitmask.NewBitMask(numaNodes...); err == nil && len(numaNodes) > 0 {
+		mf.Width = len(all.String())
+	}
+	return mf
+}
+
+func (mf MaskFormatter) Mask(mask bitmask.BitMask) string {
+	if mask == nil {
+		return nilHints
+	}
+	switch mf.Format {
+	case MaskFormatHex:
+		var val uint64
+		for _, bit := range mask.GetBits() {
+			val |= 1 << uint(bit)
+		}
+		return fmt.Sprintf("0x%02x", val)
+	case MaskFormatList:
+		// with the prefix, like ParseMask wants it
+		return maskPrefixNodes + cpuset.NewCPUSet(mask.GetBits()...).String()
+	}
+	s := mask.String()
+	if len(s) < mf.Width {
+		s = strings.Repeat("0", mf.Width-len(s)) + s
+	}
+	return s
+}
+
+func (mf MaskFormatter) Hint(ht topologymanager.TopologyHint) string {
+	return fmt.Sprintf("{%s %v}", mf.Mask(ht.NUMANodeAffinity), ht.Preferred)
+}
+
+// Hints tells apart a nil hint list (no preference) from an empty one (no possible affinity)
+func (mf MaskFormatter) Hints(hts []topologymanager.TopologyHint) string {
+	if hts == nil {
+		return nilHints
+	}
+	items := make([]string, 0, len(hts))
+	for _, ht := range hts {
+		items = append(items, mf.Hint(ht))
+	}
+	return "[" + strings.Join(items, " ") + "]"
+}
+
+func FormatMask(mask bitmask.BitMask, format string) string {
+	return MaskFormatter{Format: format}.Mask(mask)
+}
+
+func FormatHint(ht topologymanager.TopologyHint, format string) string {
+	return MaskFormatter{Format: format}.Hint(ht)
+}
+
+func FormatHints(hts []topologymanager.TopologyHint, format string) string {
+	return MaskFormatter{Format: format}.Hints(hts)
+}
@@ -0,0 +1,96 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package hints
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMask(t *testing.T) {
+	type testCase struct {
+		input string
+		// nodes is nil if the mask must be rejected
+		nodes []int
+	}
+
+	testCases := []testCase{
+		{input: "01", nodes: []int{0}},
+		{input: "0011", nodes: []int{0, 1}},
+		{input: "1", nodes: []int{0}},
+		{input: "10", nodes: []int{1}},
+		{input: "11", nodes: []int{0, 1}},
+		{input: "0", nodes: []int{}},
+		{input: "0b01", nodes: []int{0}},
+		{input: "0b1010", nodes: []int{1, 3}},
+		{input: "0x5", nodes: []int{0, 2}},
+		{input: "nodes=0,2", nodes: []int{0, 2}},
+		{input: "nodes=4-7", nodes: []int{4, 5, 6, 7}},
+		{input: "nodes=10", nodes: []int{10}},
+		{input: ""},
+		{input: "0b"},
+		{input: "0b12"},
+		{input: "0xg"},
+		{input: "0,2"},
+		{input: "4-7"},
+		{input: "2"},
+		{input: "nodes=", nodes: []int{}},
+		{input: "nodes=2-1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			mask, err := ParseMask(tc.input)
+			if tc.nodes == nil {
+				if err == nil {
+					t.Errorf("expected error, got %v", mask)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if nodes := append([]int{}, mask.GetBits()...); !reflect.DeepEqual(nodes, tc.nodes) {
+				t.Errorf("got %v expected %v", nodes, tc.nodes)
+			}
+		})
+	}
+}
+
+// The JSON example of the README predates the other mask notations and must keep its meaning
+func TestParseJSONBinaryMasks(t *testing.T) {
+	phs, err := ParseJSON([]string{
+		`{"R":"cpu", "H":[{"M":"01","P":true},{"M":"10","P":true},{"M":"11","P":false}]}`,
+		`{"R":"nvidia.com/gpu", "H":[{"M":"01","P":true},{"M":"11","P":false}]}`,
+		`{"R":"openshift.io/intelsriov", "H":[{"M":"10","P":true},{"M":"11","P":false}]}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"cpu":                     "[{01 true} {10 true} {11 false}]",
+		"nvidia.com/gpu":          "[{01 true} {11 false}]",
+		"openshift.io/intelsriov": "[{10 true} {11 false}]",
+	}
+	for _, ph := range phs {
+		for res, hints := range ph.Hints {
+			if got := FormatHints(hints, MaskFormatBinary); got != expected[res] {
+				t.Errorf("%s: expected %s, got %s", res, expected[res], got)
+			}
+		}
+	}
+}
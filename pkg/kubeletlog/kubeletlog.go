@@ -0,0 +1,343 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package kubeletlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+	"github.com/fromanirh/tmpolx/pkg/tmpolx"
+)
+
+/*
+The topology manager scopes log the hints of each provider, then the merged best hint:
+
+container scope (scope_container.go):
+I1018 10:00:00.000000    1234 scope_container.go:80] "TopologyHints" hints=map[cpu:[{NUMANodeAffinity:01 Preferred:true}]] pod="ns/name" containerName="cnt"
+I1018 10:00:00.000000    1234 scope_container.go:52] "Best TopologyHint" bestHint={NUMANodeAffinity:01 Preferred:true} pod="ns/name" containerName="cnt"
+
+pod scope (scope_pod.go):
+I1018 10:00:00.000000    1234 scope_pod.go:80] "TopologyHints" hints=map[cpu:[{NUMANodeAffinity:01 Preferred:true}]] pod="ns/name"
+I1018 10:00:00.000000    1234 scope_pod.go:51] "Best TopologyHint" bestHint={NUMANodeAffinity:01 Preferred:true} pod="ns/name"
+
+Note the kubelet logs both nil (no preference) and empty (no possible affinity) hint lists as "[]".
+The policies other than none tell them apart merging the hints (policy.go), before the best hint is logged:
+
+I1018 10:00:00.000000    1234 policy.go:80] "Hint Provider has no preference for NUMA affinity with resource" resource="nvidia.com/gpu"
+I1018 10:00:00.000000    1234 policy.go:86] "Hint Provider has no possible NUMA affinities for resource" resource="memory"
+
+These entries have no pod, and belong to the admission whose hints were logged last: the kubelet admits one pod at a time.
+Hint lists logged as "[]" are read back as nil or empty accordingly; if the entries are missing, as empty, and the
+resources are reported as ambiguous.
+*/
+
+const (
+	msgTopologyHints = `"TopologyHints"`
+	msgBestHint      = `"Best TopologyHint"`
+	msgNoPreference  = `"Hint Provider has no preference for NUMA affinity with resource"`
+	msgNoAffinity    = `"Hint Provider has no possible NUMA affinities for resource"`
+)
+
+const (
+	ProviderCPUManager    = "cpumanager"
+	ProviderMemoryManager = "memorymanager"
+	ProviderDeviceManager = "devicemanager"
+)
+
+// Admission holds the merge input of a pod (pod scope) or a container (container scope) admission,
+// as reconstructed from the kubelet log.
+type Admission struct {
+	Pod       string
+	Container string
+	Scope     string
+	Providers []tmhints.ProviderHints
+	// BestHint is the merged hint logged by the kubelet, nil if missing from the log
+	BestHint *topologymanager.TopologyHint
+	// Line is the line number of the "Best TopologyHint" entry, or of the last
+	// "TopologyHints" entry if the former is missing
+	Line int
+	// Ambiguous lists the resources logged with no hints which can be either nil or empty, sorted
+	Ambiguous []string
+}
+
+func (adm Admission) String() string {
+	if adm.Container == "" {
+		return fmt.Sprintf("pod=%q", adm.Pod)
+	}
+	return fmt.Sprintf("pod=%q container=%q", adm.Pod, adm.Container)
+}
+
+// ToParams fills the given params with the hints and the scope of the admission.
+func (adm Admission) ToParams(params tmpolx.Params) tmpolx.Params {
+	params.ScopeName = adm.Scope
+	params.RawHints = nil
+	params.ProviderHints = adm.Providers
+	return params
+}
+
+type pendingAdmission struct {
+	adm Admission
+	rhs []tmhints.ResHints
+	// number of "TopologyHints" entries, one per provider
+	count int
+	// resources the policy logged with no preference (nil hints) or with no possible affinity (empty hints)
+	noPreference map[string]bool
+	noAffinity   map[string]bool
+}
+
+func (pa *pendingAdmission) complete() (Admission, error) {
+	ambiguous := make(map[string]bool)
+	for idx, rh := range pa.rhs {
+		if rh.Resource == "" || len(rh.Hints) > 0 {
+			continue
+		}
+		switch {
+		case pa.noPreference[rh.Resource] && !pa.noAffinity[rh.Resource]:
+			pa.rhs[idx].Hints = nil
+		case pa.noAffinity[rh.Resource] && !pa.noPreference[rh.Resource]:
+			pa.rhs[idx].Hints = []tmhints.Hint{}
+		default:
+			ambiguous[rh.Resource] = true
+		}
+	}
+	pa.adm.Ambiguous = nil
+	for res := range ambiguous {
+		pa.adm.Ambiguous = append(pa.adm.Ambiguous, res)
+	}
+	sort.Strings(pa.adm.Ambiguous)
+
+	var err error
+	pa.adm.Providers, err = tmhints.Collect(pa.rhs)
+	return pa.adm, err
+}
+
+// policyEntry records a policy.go entry into the admission being merged, if any
+func policyEntry(pa *pendingAdmission, line string, noPreference bool) error {
+	msg := msgNoAffinity
+	if noPreference {
+		msg = msgNoPreference
+	}
+	kvs, err := parseKeyValues(line[strings.Index(line, msg):])
+	if err != nil {
+		return err
+	}
+	res, ok := kvs["resource"]
+	if !ok {
+		return fmt.Errorf("missing resource")
+	}
+	if pa == nil {
+		return nil
+	}
+	if noPreference {
+		pa.noPreference[res] = true
+	} else {
+		pa.noAffinity[res] = true
+	}
+	return nil
+}
+
+func Parse(r io.Reader) ([]Admission, error) {
+	var admissions []Admission
+	var pendingKeys []string
+	pendings := make(map[string]*pendingAdmission)
+	// the admission whose hints were logged last, which the policy is merging
+	var merging *pendingAdmission
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		if noPreference := strings.Contains(line, msgNoPreference); noPreference || strings.Contains(line, msgNoAffinity) {
+			if err := policyEntry(merging, line, noPreference); err != nil {
+				return admissions, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			continue
+		}
+
+		isHints := true
+		idx := strings.Index(line, msgTopologyHints)
+		if idx == -1 {
+			isHints = false
+			idx = strings.Index(line, msgBestHint)
+		}
+		if idx == -1 {
+			continue
+		}
+
+		kvs, err := parseKeyValues(line[idx:])
+		if err != nil {
+			return admissions, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		pod, ok := kvs["pod"]
+		if !ok {
+			return admissions, fmt.Errorf("line %d: missing pod", lineNo)
+		}
+		container := kvs["containerName"]
+		key := pod + "/" + container
+
+		pa, ok := pendings[key]
+		if !ok {
+			pa = &pendingAdmission{
+				adm: Admission{
+					Pod:       pod,
+					Container: container,
+					Scope:     tmpolx.ScopeContainer,
+				},
+				noPreference: make(map[string]bool),
+				noAffinity:   make(map[string]bool),
+			}
+			if container == "" {
+				pa.adm.Scope = tmpolx.ScopePod
+			}
+			pendings[key] = pa
+			pendingKeys = append(pendingKeys, key)
+		}
+		pa.adm.Line = lineNo
+
+		if isHints {
+			rhs, err := tmhints.ParseGOMap(1, kvs["hints"])
+			if err != nil {
+				return admissions, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			pa.rhs = append(pa.rhs, withProvider(rhs, pa.count)...)
+			pa.count++
+			merging = pa
+			continue
+		}
+
+		ht, err := tmhints.ParseGOHint(1, kvs["bestHint"])
+		if err != nil {
+			return admissions, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		bestHint, err := ht.ToTM()
+		if err != nil {
+			return admissions, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		pa.adm.BestHint = &bestHint
+
+		adm, err := pa.complete()
+		if err != nil {
+			return admissions, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		admissions = append(admissions, adm)
+		delete(pendings, key)
+		if merging == pa {
+			merging = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return admissions, err
+	}
+
+	// excerpts may be truncated before the "Best TopologyHint" entries
+	for _, key := range pendingKeys {
+		pa, ok := pendings[key]
+		if !ok {
+			continue
+		}
+		adm, err := pa.complete()
+		if err != nil {
+			return admissions, fmt.Errorf("line %d: %w", pa.adm.Line, err)
+		}
+		admissions = append(admissions, adm)
+		delete(pendings, key)
+	}
+	return admissions, nil
+}
+
+// withProvider names the provider which reported the hints. Providers are not logged,
+// so their name is inferred from the resources they report hints for.
+func withProvider(rhs []tmhints.ResHints, count int) []tmhints.ResHints {
+	name := "provider"
+	for _, rh := range rhs {
+		if rh.Resource == "cpu" {
+			name = ProviderCPUManager
+			break
+		}
+		if rh.Resource == "memory" || strings.HasPrefix(rh.Resource, "hugepages-") {
+			name = ProviderMemoryManager
+			break
+		}
+		name = ProviderDeviceManager
+	}
+	// avoid to merge the hints of different providers
+	name = fmt.Sprintf("%s#%d", name, count)
+
+	if len(rhs) == 0 {
+		return []tmhints.ResHints{{Provider: name}}
+	}
+	for idx := range rhs {
+		rhs[idx].Provider = name
+	}
+	return rhs
+}
+
+// parseKeyValues parses the key=value pairs of a structured log entry, starting with the quoted message.
+func parseKeyValues(s string) (map[string]string, error) {
+	kvs := make(map[string]string)
+	msg, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return kvs, fmt.Errorf("malformed message: %w", err)
+	}
+	s = s[len(msg):]
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return kvs, nil
+		}
+		idx := strings.IndexByte(s, '=')
+		if idx == -1 {
+			return kvs, fmt.Errorf("malformed key/value pair %q", s)
+		}
+		key := s[:idx]
+		s = s[idx+1:]
+
+		if strings.HasPrefix(s, `"`) {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return kvs, fmt.Errorf("malformed value for %q: %w", key, err)
+			}
+			kvs[key], _ = strconv.Unquote(quoted)
+			s = s[len(quoted):]
+			continue
+		}
+
+		depth := 0
+		end := 0
+		for end < len(s) && (depth > 0 || s[end] != ' ') {
+			switch s[end] {
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+			}
+			end++
+		}
+		kvs[key] = s[:end]
+		s = s[end:]
+	}
+}
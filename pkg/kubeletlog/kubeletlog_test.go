@@ -0,0 +1,121 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package kubeletlog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	logHints = `I1018 10:07:02.114262    2135 scope_container.go:80] "TopologyHints" hints=map[cpu:[{NUMANodeAffinity:01 Preferred:true} {NUMANodeAffinity:11 Preferred:false}]] pod="default/pod" containerName="app"
+I1018 10:07:02.114280    2135 scope_container.go:80] "TopologyHints" hints=map[openshift.io/intelsriov:[] nvidia.com/gpu:[]] pod="default/pod" containerName="app"
+`
+	logNoPreference = `I1018 10:07:02.114315    2135 policy.go:80] "Hint Provider has no preference for NUMA affinity with resource" resource="openshift.io/intelsriov"
+`
+	logNoAffinity = `I1018 10:07:02.114320    2135 policy.go:86] "Hint Provider has no possible NUMA affinities for resource" resource="nvidia.com/gpu"
+`
+	logBestHint = `I1018 10:07:02.114352    2135 scope_container.go:55] "Best TopologyHint" bestHint={NUMANodeAffinity:01 Preferred:true} pod="default/pod" containerName="app"
+`
+)
+
+func TestParseNilAndEmptyHints(t *testing.T) {
+	type testCase struct {
+		name      string
+		log       string
+		nilHints  []string
+		ambiguous []string
+	}
+
+	testCases := []testCase{
+		{
+			name:      "no policy entries",
+			log:       logHints + logBestHint,
+			ambiguous: []string{"nvidia.com/gpu", "openshift.io/intelsriov"},
+		},
+		{
+			name:      "no preference",
+			log:       logHints + logNoPreference + logBestHint,
+			nilHints:  []string{"openshift.io/intelsriov"},
+			ambiguous: []string{"nvidia.com/gpu"},
+		},
+		{
+			name:     "no preference and no possible affinity",
+			log:      logHints + logNoPreference + logNoAffinity + logBestHint,
+			nilHints: []string{"openshift.io/intelsriov"},
+		},
+		{
+			name:      "policy entries before the hints",
+			log:       logNoPreference + logNoAffinity + logHints + logBestHint,
+			ambiguous: []string{"nvidia.com/gpu", "openshift.io/intelsriov"},
+		},
+		{
+			name:     "truncated log",
+			log:      logHints + logNoPreference + logNoAffinity,
+			nilHints: []string{"openshift.io/intelsriov"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			admissions, err := Parse(strings.NewReader(tc.log))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(admissions) != 1 {
+				t.Fatalf("expected 1 admission, got %d", len(admissions))
+			}
+			adm := admissions[0]
+			if !reflect.DeepEqual(adm.Ambiguous, tc.ambiguous) {
+				t.Errorf("got ambiguous resources %v expected %v", adm.Ambiguous, tc.ambiguous)
+			}
+
+			var nilHints []string
+			for _, ph := range adm.Providers {
+				for _, res := range ph.ResourceNames(true) {
+					if ph.Hints[res] == nil {
+						nilHints = append(nilHints, res)
+					}
+				}
+			}
+			if !reflect.DeepEqual(nilHints, tc.nilHints) {
+				t.Errorf("got nil hints for %v expected %v", nilHints, tc.nilHints)
+			}
+		})
+	}
+}
+
+func TestParsePolicyEntriesBelongToTheLastAdmission(t *testing.T) {
+	other := strings.ReplaceAll(logHints, `pod="default/pod"`, `pod="default/other"`)
+	otherBest := strings.ReplaceAll(logBestHint, `pod="default/pod"`, `pod="default/other"`)
+	log := logHints + logBestHint + other + logNoPreference + otherBest
+
+	admissions, err := Parse(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(admissions) != 2 {
+		t.Fatalf("expected 2 admissions, got %d", len(admissions))
+	}
+	if !reflect.DeepEqual(admissions[0].Ambiguous, []string{"nvidia.com/gpu", "openshift.io/intelsriov"}) {
+		t.Errorf("unexpected ambiguous resources for %s: %v", admissions[0].String(), admissions[0].Ambiguous)
+	}
+	if !reflect.DeepEqual(admissions[1].Ambiguous, []string{"nvidia.com/gpu"}) {
+		t.Errorf("unexpected ambiguous resources for %s: %v", admissions[1].String(), admissions[1].Ambiguous)
+	}
+}
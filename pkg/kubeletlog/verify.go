@@ -0,0 +1,102 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package kubeletlog
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+
+	"github.com/fromanirh/tmpolx/pkg/tmpolx"
+)
+
+// Verification is the outcome of replaying an admission found in the kubelet log.
+type Verification struct {
+	Admission Admission
+	TMPolx    *tmpolx.TMPolx
+	// Hint and Admit are the recomputed merge result
+	Hint  topologymanager.TopologyHint
+	Admit bool
+	// MatchingPolicies lists the policies whose merge result matches the logged one
+	MatchingPolicies []string
+	// Error is why the admission couldn't be replayed
+	Error error
+}
+
+// Verified tells if the logged best hint was found and the admission could be replayed, and then verified at all.
+func (vr Verification) Verified() bool {
+	return vr.Error == nil && vr.Admission.BestHint != nil
+}
+
+func (vr Verification) Matches() bool {
+	return vr.Verified() && vr.Admission.BestHint.IsEqual(vr.Hint)
+}
+
+func (vr Verification) String() string {
+	if vr.Error != nil {
+		return fmt.Sprintf("ERROR %s at line %d: %v", vr.Admission.String(), vr.Admission.Line, vr.Error)
+	}
+	if !vr.Verified() {
+		return fmt.Sprintf("SKIP %s: missing \"Best TopologyHint\" entry", vr.Admission.String())
+	}
+	if vr.Matches() {
+		return fmt.Sprintf("OK   %s: hint=%v", vr.Admission.String(), vr.Hint)
+	}
+	line := fmt.Sprintf("MISMATCH %s at line %d: logged hint=%v computed hint=%v admit=%v", vr.Admission.String(), vr.Admission.Line, *vr.Admission.BestHint, vr.Hint, vr.Admit)
+	if len(vr.MatchingPolicies) > 0 {
+		line += fmt.Sprintf(", matching policies: %v", vr.MatchingPolicies)
+	}
+	if len(vr.Admission.Ambiguous) > 0 {
+		line += fmt.Sprintf(", resources logged with no hints (nil or empty): %v", vr.Admission.Ambiguous)
+	}
+	return line
+}
+
+// Verify recomputes the merge of an admission with the given params (policy, NUMA nodes...),
+// and compares the result with the best hint the kubelet logged. If the admission can't be
+// replayed, the Verification holds the Error.
+func Verify(adm Admission, params tmpolx.Params) Verification {
+	vr := Verification{
+		Admission: adm,
+	}
+	vr.TMPolx, vr.Hint, vr.Admit, vr.Error = replay(adm, params)
+	if !vr.Verified() || vr.Matches() {
+		return vr
+	}
+
+	for _, name := range tmpolx.AllPolicies {
+		params.PolicyName = name
+		_, hint, _, err := replay(adm, params)
+		if err != nil {
+			// the other policies can't replay the admission either: it's an input error, already found
+			continue
+		}
+		if adm.BestHint.IsEqual(hint) {
+			vr.MatchingPolicies = append(vr.MatchingPolicies, name)
+		}
+	}
+	return vr
+}
+
+func replay(adm Admission, params tmpolx.Params) (*tmpolx.TMPolx, topologymanager.TopologyHint, bool, error) {
+	tmpx, err := tmpolx.NewFromParams(adm.ToParams(params))
+	if err != nil {
+		return nil, topologymanager.TopologyHint{}, false, err
+	}
+	hint, admit := tmpx.Merge()
+	return tmpx, hint, admit, nil
+}
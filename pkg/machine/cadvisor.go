@@ -0,0 +1,80 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	cadvisorapi "github.com/google/cadvisor/info/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+// LoadMachineInfo reads a cadvisor MachineInfo JSON dump, like the kubelet serves on the /spec endpoint.
+func LoadMachineInfo(path string) (*Machine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info cadvisorapi.MachineInfo
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		return nil, err
+	}
+	return FromMachineInfo(&info)
+}
+
+// FromMachineInfo builds the machine topology like the kubelet does: the NUMA nodes are the ids
+// of the nodes in info.Topology (topologymanager.NewManager), the CPUs of each node are the threads
+// of its cores (cpumanager/topology.Discover).
+func FromMachineInfo(info *cadvisorapi.MachineInfo) (*Machine, error) {
+	if len(info.Topology) == 0 {
+		return nil, fmt.Errorf("no NUMA nodes in the machine info topology")
+	}
+
+	var mach Machine
+	for _, node := range info.Topology {
+		numaNode := NUMANode{
+			ID:     node.Id,
+			Memory: resource.NewQuantity(int64(node.Memory), resource.BinarySI),
+		}
+
+		cpus := cpuset.NewCPUSet()
+		for _, core := range node.Cores {
+			threads := cpuset.NewCPUSet(core.Threads...)
+			cpus = cpus.Union(threads)
+			numaNode.Cores = append(numaNode.Cores, threads.String())
+		}
+		numaNode.CPUs = cpus.String()
+
+		for _, hp := range node.HugePages {
+			numaNode.HugePages = append(numaNode.HugePages, HugePages{
+				Size:  *resource.NewQuantity(int64(hp.PageSize)*1024, resource.BinarySI),
+				Count: int64(hp.NumPages),
+			})
+		}
+		mach.NUMANodes = append(mach.NUMANodes, numaNode)
+	}
+
+	err := mach.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("inconsistent machine info: %w", err)
+	}
+	return &mach, nil
+}
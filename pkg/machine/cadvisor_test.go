@@ -0,0 +1,107 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	cadvisorapi "github.com/google/cadvisor/info/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestLoadMachineInfo(t *testing.T) {
+	mach, err := LoadMachineInfo("../../examples/machineinfo.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := mach.NodeIDs(); !reflect.DeepEqual(ids, []int{0, 1}) {
+		t.Fatalf("unexpected NUMA nodes: %v", ids)
+	}
+	node := mach.NUMANodes[1]
+	if node.CPUs != "2-3,6-7" || !reflect.DeepEqual(node.Cores, []string{"2,6", "3,7"}) {
+		t.Errorf("unexpected cpus %q cores %v", node.CPUs, node.Cores)
+	}
+	if node.Memory == nil || node.Memory.Cmp(resource.MustParse("32Gi")) != 0 {
+		t.Errorf("unexpected memory: %v", node.Memory)
+	}
+	expected := []HugePages{
+		{Size: resource.MustParse("1Gi"), Count: 2},
+		{Size: resource.MustParse("2Mi"), Count: 512},
+	}
+	if len(node.HugePages) != len(expected) {
+		t.Fatalf("unexpected hugepages: %v", node.HugePages)
+	}
+	for idx, hp := range node.HugePages {
+		if hp.Size.Cmp(expected[idx].Size) != 0 || hp.Count != expected[idx].Count {
+			t.Errorf("hugepages #%d: expected %v, got %v", idx, expected[idx], hp)
+		}
+	}
+	if mach.HasDistances() {
+		t.Errorf("cadvisor doesn't report the NUMA distances")
+	}
+}
+
+func TestLoadMachineInfoMemoryNode(t *testing.T) {
+	mach, err := LoadMachineInfo("testdata/machineinfo-memory-node.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := mach.NodeIDs(); !reflect.DeepEqual(ids, []int{0, 1}) {
+		t.Fatalf("unexpected NUMA nodes: %v", ids)
+	}
+	if cpus := mach.NUMANodes[0].CPUs; cpus != "0-3" {
+		t.Errorf("unexpected cpus of NUMA node 0: %q", cpus)
+	}
+	memNode := mach.NUMANodes[1]
+	if memNode.CPUs != "" || len(memNode.Cores) != 0 || len(memNode.HugePages) != 0 {
+		t.Errorf("expected a memory-only NUMA node, got %+v", memNode)
+	}
+	if memNode.Memory == nil || memNode.Memory.Cmp(resource.MustParse("64Gi")) != 0 {
+		t.Errorf("unexpected memory: %v", memNode.Memory)
+	}
+}
+
+func TestFromMachineInfoErrors(t *testing.T) {
+	type testCase struct {
+		name string
+		info cadvisorapi.MachineInfo
+	}
+
+	testCases := []testCase{
+		{name: "no topology", info: cadvisorapi.MachineInfo{}},
+		{
+			name: "duplicate NUMA node",
+			info: cadvisorapi.MachineInfo{Topology: []cadvisorapi.Node{{Id: 0}, {Id: 0}}},
+		},
+		{
+			name: "cpus on two NUMA nodes",
+			info: cadvisorapi.MachineInfo{Topology: []cadvisorapi.Node{
+				{Id: 0, Cores: []cadvisorapi.Core{{Id: 0, Threads: []int{0, 1}}}},
+				{Id: 1, Cores: []cadvisorapi.Core{{Id: 1, Threads: []int{1, 2}}}},
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := FromMachineInfo(&tc.info); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package machine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+A machine topology file describes the NUMA layout of a machine, in YAML or JSON format:
+
+numaNodes:
+- id: 0
+  cpus: "0-3,8-11"
+  cores: ["0,8", "1,9", "2,10", "3,11"]  # optional, the thread siblings of each physical core
+  memory: 64Gi
+  hugepages:
+  - size: 1Gi
+    count: 4
+  distances: [10, 21]                    # distance to each NUMA node, sorted by id
+  resources:                             # optional, the per-node resources accounting
+  - name: cpu
+    capacity: "8"
+    allocatable: "6"
+    available: "2"
+- id: 1
+  cpus: "4-7,12-15"
+  memory: 64Gi
+  distances: [21, 10]
+devices:
+- resource: nvidia.com/gpu
+  id: "0000:3b:00.0"
+  numaNode: 0
+policy: single-numa-node                 # optional, the topology manager policy configured on the machine
+scope: container                         # optional, the topology manager scope configured on the machine
+*/
+
+type HugePages struct {
+	Size  resource.Quantity `json:"size"`
+	Count int64             `json:"count"`
+}
+
+type Resource struct {
+	Name        string            `json:"name"`
+	Capacity    resource.Quantity `json:"capacity"`
+	Allocatable resource.Quantity `json:"allocatable"`
+	Available   resource.Quantity `json:"available"`
+}
+
+type NUMANode struct {
+	ID        int                `json:"id"`
+	CPUs      string             `json:"cpus,omitempty"`
+	Cores     []string           `json:"cores,omitempty"`
+	Memory    *resource.Quantity `json:"memory,omitempty"`
+	HugePages []HugePages        `json:"hugepages,omitempty"`
+	Distances []int              `json:"distances,omitempty"`
+	Resources []Resource         `json:"resources,omitempty"`
+}
+
+type Device struct {
+	Resource string `json:"resource"`
+	ID       string `json:"id,omitempty"`
+	NUMANode int    `json:"numaNode"`
+}
+
+type Machine struct {
+	NUMANodes []NUMANode `json:"numaNodes"`
+	Devices   []Device   `json:"devices,omitempty"`
+	Policy    string     `json:"policy,omitempty"`
+	Scope     string     `json:"scope,omitempty"`
+}
+
+func Load(path string) (*Machine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Machine, error) {
+	var mach Machine
+	err := yaml.UnmarshalStrict(data, &mach)
+	if err != nil {
+		return nil, err
+	}
+	err = mach.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &mach, nil
+}
+
+func (mach *Machine) Validate() error {
+	if len(mach.NUMANodes) == 0 {
+		return fmt.Errorf("no NUMA nodes")
+	}
+	sort.Slice(mach.NUMANodes, func(i, j int) bool {
+		return mach.NUMANodes[i].ID < mach.NUMANodes[j].ID
+	})
+
+	allCPUs := cpuset.NewCPUSet()
+	for idx, node := range mach.NUMANodes {
+		if node.ID < 0 {
+			return fmt.Errorf("NUMA node %d: invalid id", node.ID)
+		}
+		if idx > 0 && mach.NUMANodes[idx-1].ID == node.ID {
+			return fmt.Errorf("NUMA node %d: duplicate id", node.ID)
+		}
+
+		cpus, err := cpuset.Parse(node.CPUs)
+		if err != nil {
+			return fmt.Errorf("NUMA node %d: bad format for cpus: %w", node.ID, err)
+		}
+		if !cpus.Intersection(allCPUs).IsEmpty() {
+			return fmt.Errorf("NUMA node %d: cpus %v belong to other NUMA nodes", node.ID, cpus.Intersection(allCPUs))
+		}
+		allCPUs = allCPUs.Union(cpus)
+
+		coreCPUs := cpuset.NewCPUSet()
+		for _, core := range node.Cores {
+			siblings, err := cpuset.Parse(core)
+			if err != nil {
+				return fmt.Errorf("NUMA node %d: bad format for core %q: %w", node.ID, core, err)
+			}
+			if !siblings.Intersection(coreCPUs).IsEmpty() {
+				return fmt.Errorf("NUMA node %d: core %q overlaps other cores", node.ID, core)
+			}
+			coreCPUs = coreCPUs.Union(siblings)
+		}
+		if len(node.Cores) > 0 && !coreCPUs.Equals(cpus) {
+			return fmt.Errorf("NUMA node %d: cores %v don't match cpus %v", node.ID, coreCPUs, cpus)
+		}
+
+		if node.Memory != nil && node.Memory.Sign() < 0 {
+			return fmt.Errorf("NUMA node %d: negative memory", node.ID)
+		}
+		for _, hp := range node.HugePages {
+			if hp.Size.Sign() <= 0 || hp.Count < 0 {
+				return fmt.Errorf("NUMA node %d: invalid hugepages size=%v count=%d", node.ID, hp.Size.String(), hp.Count)
+			}
+		}
+		if len(node.Distances) > 0 && len(node.Distances) != len(mach.NUMANodes) {
+			return fmt.Errorf("NUMA node %d: expected %d distances, got %d", node.ID, len(mach.NUMANodes), len(node.Distances))
+		}
+		for _, res := range node.Resources {
+			if res.Name == "" {
+				return fmt.Errorf("NUMA node %d: missing resource name", node.ID)
+			}
+			if res.Capacity.Sign() < 0 || res.Allocatable.Sign() < 0 || res.Available.Sign() < 0 {
+				return fmt.Errorf("NUMA node %d: resource %q: negative amount", node.ID, res.Name)
+			}
+		}
+	}
+
+	for _, dev := range mach.Devices {
+		if dev.Resource == "" {
+			return fmt.Errorf("device %q: missing resource name", dev.ID)
+		}
+		if mach.findNode(dev.NUMANode) == -1 {
+			return fmt.Errorf("device %q (%s): unknown NUMA node %d", dev.ID, dev.Resource, dev.NUMANode)
+		}
+	}
+	return nil
+}
+
+func (mach *Machine) findNode(id int) int {
+	for idx, node := range mach.NUMANodes {
+		if node.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+// NodeIDs returns the sorted NUMA node ids
+func (mach *Machine) NodeIDs() []int {
+	var ids []int
+	for _, node := range mach.NUMANodes {
+		ids = append(ids, node.ID)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (mach *Machine) NodeCPUs(id int) (cpuset.CPUSet, error) {
+	idx := mach.findNode(id)
+	if idx == -1 {
+		return cpuset.NewCPUSet(), fmt.Errorf("unknown NUMA node %d", id)
+	}
+	return cpuset.Parse(mach.NUMANodes[idx].CPUs)
+}
+
+// HasDistances tells if the NUMA distance matrix is available
+func (mach *Machine) HasDistances() bool {
+	for _, node := range mach.NUMANodes {
+		if len(node.Distances) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (mach *Machine) Distance(from, to int) (int, error) {
+	src := mach.findNode(from)
+	if src == -1 {
+		return 0, fmt.Errorf("unknown NUMA node %d", from)
+	}
+	dst := mach.findNode(to)
+	if dst == -1 {
+		return 0, fmt.Errorf("unknown NUMA node %d", to)
+	}
+	if len(mach.NUMANodes[src].Distances) == 0 {
+		return 0, fmt.Errorf("missing distances for NUMA node %d", from)
+	}
+	return mach.NUMANodes[src].Distances[dst], nil
+}
+
+func (mach *Machine) String() string {
+	return fmt.Sprintf("machine with NUMA nodes %v", mach.NodeIDs())
+}
@@ -0,0 +1,260 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package machine
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"sigs.k8s.io/yaml"
+)
+
+/*
+A NodeResourceTopology (NRT) object, as published by the resource-topology-exporter, holds the
+per-NUMA zone resources accounting of a node. Only the fields tmpolx needs are decoded, so
+both the v1alpha1 and the v1alpha2 objects are accepted:
+
+apiVersion: topology.node.k8s.io/v1alpha2
+kind: NodeResourceTopology
+metadata:
+  name: worker-0
+attributes:                  # v1alpha2
+- name: topologyManagerPolicy
+  value: single-numa-node
+- name: topologyManagerScope
+  value: container
+topologyPolicies:            # v1alpha1, used only if attributes are missing
+- SingleNUMANodeContainerLevel
+zones:
+- name: node-0
+  type: Node
+  costs:
+  - name: node-0
+    value: 10
+  - name: node-1
+    value: 21
+  resources:
+  - name: cpu
+    capacity: "8"
+    allocatable: "6"
+    available: "2"
+*/
+
+const (
+	nrtZoneTypeNode   = "Node"
+	nrtZonePrefix     = "node-"
+	nrtAttrPolicy     = "topologyManagerPolicy"
+	nrtAttrScope      = "topologyManagerScope"
+	nrtScopeContainer = "container"
+	nrtScopePod       = "pod"
+)
+
+type nrtAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type nrtCost struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+type nrtResource struct {
+	Name        string            `json:"name"`
+	Capacity    resource.Quantity `json:"capacity"`
+	Allocatable resource.Quantity `json:"allocatable"`
+	Available   resource.Quantity `json:"available"`
+}
+
+type nrtZone struct {
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	Costs     []nrtCost     `json:"costs,omitempty"`
+	Resources []nrtResource `json:"resources,omitempty"`
+}
+
+type nrtObject struct {
+	Kind             string         `json:"kind"`
+	TopologyPolicies []string       `json:"topologyPolicies,omitempty"`
+	Attributes       []nrtAttribute `json:"attributes,omitempty"`
+	Zones            []nrtZone      `json:"zones"`
+}
+
+// v1alpha1 policies, see the NRT API TopologyManagerPolicy type
+var nrtTopologyPolicies = map[string][2]string{
+	"None":                         {topologymanager.PolicyNone, ""},
+	"BestEffort":                   {topologymanager.PolicyBestEffort, ""},
+	"BestEffortContainerLevel":     {topologymanager.PolicyBestEffort, nrtScopeContainer},
+	"BestEffortPodLevel":           {topologymanager.PolicyBestEffort, nrtScopePod},
+	"Restricted":                   {topologymanager.PolicyRestricted, ""},
+	"RestrictedContainerLevel":     {topologymanager.PolicyRestricted, nrtScopeContainer},
+	"RestrictedPodLevel":           {topologymanager.PolicyRestricted, nrtScopePod},
+	"SingleNUMANodeContainerLevel": {topologymanager.PolicySingleNumaNode, nrtScopeContainer},
+	"SingleNUMANodePodLevel":       {topologymanager.PolicySingleNumaNode, nrtScopePod},
+}
+
+func LoadNRT(path string) (*Machine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNRT(data)
+}
+
+// ParseNRT builds the machine topology out of a NodeResourceTopology object. Each zone of type Node
+// named "node-N" becomes the NUMA node N; the zone costs become the NUMA distances.
+func ParseNRT(data []byte) (*Machine, error) {
+	var nrt nrtObject
+	err := yaml.Unmarshal(data, &nrt)
+	if err != nil {
+		return nil, err
+	}
+	if nrt.Kind != "" && nrt.Kind != "NodeResourceTopology" {
+		return nil, fmt.Errorf("unexpected kind %q", nrt.Kind)
+	}
+
+	var mach Machine
+	mach.Policy, mach.Scope, err = nrtPolicyAndScope(nrt)
+	if err != nil {
+		return nil, err
+	}
+
+	costs := make(map[int][]nrtCost)
+	for _, zone := range nrt.Zones {
+		if zone.Type != nrtZoneTypeNode {
+			continue
+		}
+		id, err := nrtZoneID(zone.Name)
+		if err != nil {
+			return nil, err
+		}
+		node := NUMANode{ID: id}
+		for _, res := range zone.Resources {
+			node.Resources = append(node.Resources, Resource(res))
+			if err := node.addNRTResource(res); err != nil {
+				return nil, fmt.Errorf("zone %q: %w", zone.Name, err)
+			}
+		}
+		costs[id] = zone.Costs
+		mach.NUMANodes = append(mach.NUMANodes, node)
+	}
+
+	err = mach.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("inconsistent NodeResourceTopology: %w", err)
+	}
+
+	err = mach.setNRTDistances(costs)
+	if err != nil {
+		return nil, err
+	}
+	return &mach, nil
+}
+
+func nrtZoneID(name string) (int, error) {
+	if !strings.HasPrefix(name, nrtZonePrefix) {
+		return -1, fmt.Errorf("zone %q: expected name %q", name, nrtZonePrefix+"N")
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(name, nrtZonePrefix))
+	if err != nil {
+		return -1, fmt.Errorf("zone %q: bad format for NUMA node id: %w", name, err)
+	}
+	return id, nil
+}
+
+func nrtPolicyAndScope(nrt nrtObject) (string, string, error) {
+	var policy, scope string
+	for _, attr := range nrt.Attributes {
+		switch attr.Name {
+		case nrtAttrPolicy:
+			policy = attr.Value
+		case nrtAttrScope:
+			scope = attr.Value
+		}
+	}
+	if policy != "" || len(nrt.TopologyPolicies) == 0 {
+		return policy, scope, nil
+	}
+	if len(nrt.TopologyPolicies) > 1 {
+		return "", "", fmt.Errorf("multiple topology policies: %v", nrt.TopologyPolicies)
+	}
+	ps, ok := nrtTopologyPolicies[nrt.TopologyPolicies[0]]
+	if !ok {
+		return "", "", fmt.Errorf("unknown topology policy %q", nrt.TopologyPolicies[0])
+	}
+	if scope == "" {
+		scope = ps[1]
+	}
+	return ps[0], scope, nil
+}
+
+// addNRTResource fills the memory and hugepages of the node out of the zone resources capacity.
+func (node *NUMANode) addNRTResource(res nrtResource) error {
+	name := v1.ResourceName(res.Name)
+	if name == v1.ResourceMemory {
+		mem := res.Capacity.DeepCopy()
+		node.Memory = &mem
+		return nil
+	}
+	if !strings.HasPrefix(res.Name, v1.ResourceHugePagesPrefix) {
+		return nil
+	}
+	size, err := resource.ParseQuantity(strings.TrimPrefix(res.Name, v1.ResourceHugePagesPrefix))
+	if err != nil || size.Sign() <= 0 {
+		return fmt.Errorf("bad hugepages resource name %q", res.Name)
+	}
+	node.HugePages = append(node.HugePages, HugePages{
+		Size:  size,
+		Count: res.Capacity.Value() / size.Value(),
+	})
+	return nil
+}
+
+// setNRTDistances sets the distances only if all the zones report the cost to all the other zones.
+func (mach *Machine) setNRTDistances(costs map[int][]nrtCost) error {
+	for _, node := range mach.NUMANodes {
+		if len(costs[node.ID]) == 0 {
+			return nil
+		}
+	}
+	for idx, node := range mach.NUMANodes {
+		distances := make([]int, len(mach.NUMANodes))
+		found := 0
+		for _, cost := range costs[node.ID] {
+			id, err := nrtZoneID(cost.Name)
+			if err != nil {
+				return fmt.Errorf("zone %q costs: %w", nrtZonePrefix+strconv.Itoa(node.ID), err)
+			}
+			dst := mach.findNode(id)
+			if dst == -1 {
+				return fmt.Errorf("zone %q costs: unknown zone %q", nrtZonePrefix+strconv.Itoa(node.ID), cost.Name)
+			}
+			distances[dst] = cost.Value
+			found++
+		}
+		if found != len(mach.NUMANodes) {
+			return fmt.Errorf("zone %q: expected %d costs, got %d", nrtZonePrefix+strconv.Itoa(node.ID), len(mach.NUMANodes), found)
+		}
+		mach.NUMANodes[idx].Distances = distances
+	}
+	return nil
+}
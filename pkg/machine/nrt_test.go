@@ -0,0 +1,202 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package machine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestLoadNRT(t *testing.T) {
+	mach, err := LoadNRT("../../examples/nrt.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mach.Policy != "single-numa-node" || mach.Scope != "container" {
+		t.Errorf("unexpected policy %q scope %q", mach.Policy, mach.Scope)
+	}
+	if ids := mach.NodeIDs(); !reflect.DeepEqual(ids, []int{0, 1}) {
+		t.Fatalf("unexpected NUMA nodes: %v", ids)
+	}
+	for idx, expected := range [][]int{{10, 21}, {21, 10}} {
+		if got := mach.NUMANodes[idx].Distances; !reflect.DeepEqual(got, expected) {
+			t.Errorf("NUMA node %d: expected distances %v, got %v", idx, expected, got)
+		}
+	}
+
+	node := mach.NUMANodes[0]
+	if node.Memory == nil || node.Memory.Cmp(resource.MustParse("32Gi")) != 0 {
+		t.Errorf("unexpected memory: %v", node.Memory)
+	}
+	// the count is the capacity over the page size
+	if len(node.HugePages) != 1 || node.HugePages[0].Size.Cmp(resource.MustParse("1Gi")) != 0 || node.HugePages[0].Count != 4 {
+		t.Errorf("unexpected hugepages: %v", node.HugePages)
+	}
+	if len(node.Resources) != 4 || node.Resources[0].Name != "cpu" || node.Resources[0].Available.Value() != 2 {
+		t.Errorf("unexpected resources: %v", node.Resources)
+	}
+}
+
+// newNRT returns a two zones NRT object with the given header and the given costs of the zone node-1
+func newNRT(header, costs string) string {
+	return header + `
+zones:
+- name: node-0
+  type: Node
+  costs:
+  - name: node-0
+    value: 10
+  - name: node-1
+    value: 21
+- name: node-1
+  type: Node
+` + costs
+}
+
+const nrtCostsNode1 = `  costs:
+  - name: node-0
+    value: 21
+  - name: node-1
+    value: 10
+`
+
+func TestParseNRTTopologyPolicies(t *testing.T) {
+	type testCase struct {
+		policies string
+		policy   string
+		scope    string
+	}
+
+	testCases := []testCase{
+		{policies: "None", policy: "none"},
+		{policies: "BestEffort", policy: "best-effort"},
+		{policies: "BestEffortContainerLevel", policy: "best-effort", scope: "container"},
+		{policies: "BestEffortPodLevel", policy: "best-effort", scope: "pod"},
+		{policies: "Restricted", policy: "restricted"},
+		{policies: "RestrictedContainerLevel", policy: "restricted", scope: "container"},
+		{policies: "RestrictedPodLevel", policy: "restricted", scope: "pod"},
+		{policies: "SingleNUMANodeContainerLevel", policy: "single-numa-node", scope: "container"},
+		{policies: "SingleNUMANodePodLevel", policy: "single-numa-node", scope: "pod"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policies, func(t *testing.T) {
+			mach, err := ParseNRT([]byte(newNRT("topologyPolicies:\n- "+tc.policies, nrtCostsNode1)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if mach.Policy != tc.policy || mach.Scope != tc.scope {
+				t.Errorf("expected policy %q scope %q, got policy %q scope %q", tc.policy, tc.scope, mach.Policy, mach.Scope)
+			}
+		})
+	}
+
+	// the v1alpha2 attributes win over the v1alpha1 policies
+	header := "attributes:\n- name: topologyManagerPolicy\n  value: restricted\ntopologyPolicies:\n- SingleNUMANodePodLevel"
+	mach, err := ParseNRT([]byte(newNRT(header, nrtCostsNode1)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mach.Policy != "restricted" || mach.Scope != "" {
+		t.Errorf("unexpected policy %q scope %q", mach.Policy, mach.Scope)
+	}
+}
+
+func TestParseNRTNoCosts(t *testing.T) {
+	// the distances are set only if all the zones report their costs
+	mach, err := ParseNRT([]byte(newNRT("kind: NodeResourceTopology", "")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mach.HasDistances() {
+		t.Errorf("expected no distances, got %v and %v", mach.NUMANodes[0].Distances, mach.NUMANodes[1].Distances)
+	}
+}
+
+func TestParseNRTErrors(t *testing.T) {
+	type testCase struct {
+		name string
+		data string
+		// expectedErr is a substring of the expected error
+		expectedErr string
+	}
+
+	testCases := []testCase{
+		{
+			name:        "unexpected kind",
+			data:        newNRT("kind: Node", nrtCostsNode1),
+			expectedErr: `unexpected kind "Node"`,
+		},
+		{
+			name:        "unknown topology policy",
+			data:        newNRT("topologyPolicies:\n- Aligned", nrtCostsNode1),
+			expectedErr: `unknown topology policy "Aligned"`,
+		},
+		{
+			name:        "multiple topology policies",
+			data:        newNRT("topologyPolicies:\n- None\n- Restricted", nrtCostsNode1),
+			expectedErr: "multiple topology policies",
+		},
+		{
+			name:        "missing cost",
+			data:        newNRT("", "  costs:\n  - name: node-1\n    value: 10\n"),
+			expectedErr: `zone "node-1": expected 2 costs, got 1`,
+		},
+		{
+			name:        "cost to an unknown zone",
+			data:        newNRT("", nrtCostsNode1+"  - name: node-2\n    value: 21\n"),
+			expectedErr: `unknown zone "node-2"`,
+		},
+		{
+			name:        "zone name without the node prefix",
+			data:        "zones:\n- name: numa-0\n  type: Node\n",
+			expectedErr: `zone "numa-0": expected name "node-N"`,
+		},
+		{
+			name:        "zone name with a bad id",
+			data:        "zones:\n- name: node-x\n  type: Node\n",
+			expectedErr: `zone "node-x": bad format for NUMA node id`,
+		},
+		{
+			name:        "duplicate zone",
+			data:        "zones:\n- name: node-0\n  type: Node\n- name: node-0\n  type: Node\n",
+			expectedErr: "duplicate id",
+		},
+		{
+			name:        "bad hugepages resource",
+			data:        "zones:\n- name: node-0\n  type: Node\n  resources:\n  - name: hugepages-huge\n    capacity: 1Gi\n",
+			expectedErr: `bad hugepages resource name "hugepages-huge"`,
+		},
+		{
+			name:        "no Node zones",
+			data:        "zones:\n- name: socket-0\n  type: Socket\n",
+			expectedErr: "no NUMA nodes",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseNRT([]byte(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
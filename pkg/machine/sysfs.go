@@ -0,0 +1,243 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package machine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+/*
+FromSysfs reads a snapshot of the sysfs tree, like the ones found in sosreports and must-gathers:
+
+	devices/system/node/node*\/{cpulist,distance,meminfo}
+	devices/system/node/node*\/hugepages/hugepages-*kB/nr_hugepages
+	devices/system/cpu/cpu*\/topology/thread_siblings_list
+	bus/pci/devices/*\/{numa_node,vendor,device}
+
+The root can either be the sysfs root itself or a directory containing "sys".
+*/
+
+func FromSysfs(root string) (*Machine, error) {
+	if _, err := os.Stat(filepath.Join(root, "sys", "devices", "system", "node")); err == nil {
+		root = filepath.Join(root, "sys")
+	}
+
+	nodeDirs, err := filepath.Glob(filepath.Join(root, "devices", "system", "node", "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeDirs) == 0 {
+		return nil, fmt.Errorf("no NUMA nodes found in %q", root)
+	}
+
+	var mach Machine
+	for _, nodeDir := range nodeDirs {
+		node, err := readSysfsNode(root, nodeDir)
+		if err != nil {
+			return nil, err
+		}
+		mach.NUMANodes = append(mach.NUMANodes, node)
+	}
+	sort.Slice(mach.NUMANodes, func(i, j int) bool {
+		return mach.NUMANodes[i].ID < mach.NUMANodes[j].ID
+	})
+
+	mach.Devices, err = readSysfsPCIDevices(root)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mach.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("inconsistent sysfs data in %q: %w", root, err)
+	}
+	return &mach, nil
+}
+
+func readSysfsNode(root, nodeDir string) (NUMANode, error) {
+	var node NUMANode
+	var err error
+	node.ID, err = strconv.Atoi(strings.TrimPrefix(filepath.Base(nodeDir), "node"))
+	if err != nil {
+		return node, fmt.Errorf("unexpected NUMA node directory %q: %w", nodeDir, err)
+	}
+
+	node.CPUs, err = readSysfsString(filepath.Join(nodeDir, "cpulist"))
+	if err != nil {
+		return node, err
+	}
+	cpus, err := cpuset.Parse(node.CPUs)
+	if err != nil {
+		return node, fmt.Errorf("NUMA node %d: bad format for cpulist: %w", node.ID, err)
+	}
+	node.Cores, err = readSysfsCores(root, cpus)
+	if err != nil {
+		return node, err
+	}
+
+	distances, err := readSysfsString(filepath.Join(nodeDir, "distance"))
+	if err != nil && !os.IsNotExist(err) {
+		return node, err
+	}
+	for _, item := range strings.Fields(distances) {
+		dist, err := strconv.Atoi(item)
+		if err != nil {
+			return node, fmt.Errorf("NUMA node %d: bad format for distance: %w", node.ID, err)
+		}
+		node.Distances = append(node.Distances, dist)
+	}
+
+	node.Memory, err = readSysfsMemTotal(filepath.Join(nodeDir, "meminfo"))
+	if err != nil && !os.IsNotExist(err) {
+		return node, err
+	}
+
+	node.HugePages, err = readSysfsHugePages(nodeDir)
+	if err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
+// readSysfsCores groups the given cpus by physical core. Returns nil if the cpu topology is not available.
+func readSysfsCores(root string, cpus cpuset.CPUSet) ([]string, error) {
+	var cores []string
+	seen := cpuset.NewCPUSet()
+	for _, cpu := range cpus.ToSlice() {
+		if seen.Contains(cpu) {
+			continue
+		}
+		siblings, err := readSysfsString(filepath.Join(root, "devices", "system", "cpu", fmt.Sprintf("cpu%d", cpu), "topology", "thread_siblings_list"))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		siblingCPUs, err := cpuset.Parse(siblings)
+		if err != nil {
+			return nil, fmt.Errorf("cpu %d: bad format for thread_siblings_list: %w", cpu, err)
+		}
+		seen = seen.Union(siblingCPUs)
+		cores = append(cores, siblingCPUs.String())
+	}
+	return cores, nil
+}
+
+// Node 0 MemTotal:       65536000 kB
+func readSysfsMemTotal(path string) (*resource.Quantity, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 5 || fields[2] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad format for %q: %w", path, err)
+		}
+		return resource.NewQuantity(kb*1024, resource.BinarySI), nil
+	}
+	return nil, scanner.Err()
+}
+
+func readSysfsHugePages(nodeDir string) ([]HugePages, error) {
+	var hps []HugePages
+	hpDirs, err := filepath.Glob(filepath.Join(nodeDir, "hugepages", "hugepages-*kB"))
+	if err != nil {
+		return nil, err
+	}
+	for _, hpDir := range hpDirs {
+		sizeKB, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(hpDir), "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected hugepages directory %q: %w", hpDir, err)
+		}
+		nr, err := readSysfsString(filepath.Join(hpDir, "nr_hugepages"))
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.ParseInt(nr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad format for %q: %w", hpDir, err)
+		}
+		hps = append(hps, HugePages{
+			Size:  *resource.NewQuantity(sizeKB*1024, resource.BinarySI),
+			Count: count,
+		})
+	}
+	sort.Slice(hps, func(i, j int) bool {
+		return hps[i].Size.Cmp(hps[j].Size) < 0
+	})
+	return hps, nil
+}
+
+// readSysfsPCIDevices returns the PCI devices with NUMA affinity. The resource name
+// is made up from the vendor and device ids, like "pci/8086:158b".
+func readSysfsPCIDevices(root string) ([]Device, error) {
+	var devs []Device
+	devDirs, err := filepath.Glob(filepath.Join(root, "bus", "pci", "devices", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, devDir := range devDirs {
+		numaNode, err := readSysfsString(filepath.Join(devDir, "numa_node"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		node, err := strconv.Atoi(numaNode)
+		if err != nil {
+			return nil, fmt.Errorf("bad format for %q: %w", devDir, err)
+		}
+		if node < 0 {
+			continue
+		}
+		vendor, _ := readSysfsString(filepath.Join(devDir, "vendor"))
+		device, _ := readSysfsString(filepath.Join(devDir, "device"))
+		devs = append(devs, Device{
+			Resource: fmt.Sprintf("pci/%s:%s", strings.TrimPrefix(vendor, "0x"), strings.TrimPrefix(device, "0x")),
+			ID:       filepath.Base(devDir),
+			NUMANode: node,
+		})
+	}
+	return devs, nil
+}
+
+func readSysfsString(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,193 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package machine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const sysfsFixture = "../../examples/sysfs"
+
+// copySysfsFixture copies the sysfs fixture under dir, so tests can alter it
+func copySysfsFixture(t *testing.T, dir string) {
+	t.Helper()
+	err := filepath.Walk(sysfsFixture, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sysfsFixture, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0644)
+	})
+	if err != nil {
+		t.Fatalf("copying the sysfs fixture: %v", err)
+	}
+}
+
+func TestFromSysfs(t *testing.T) {
+	mach, err := FromSysfs(sysfsFixture)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ids := mach.NodeIDs(); !reflect.DeepEqual(ids, []int{0, 1}) {
+		t.Fatalf("unexpected NUMA nodes: %v", ids)
+	}
+	expectedCPUs := map[int]string{0: "0-1,4-5", 1: "2-3,6-7"}
+	expectedCores := map[int][]string{0: {"0,4", "1,5"}, 1: {"2,6", "3,7"}}
+	for _, node := range mach.NUMANodes {
+		cpus, err := mach.NodeCPUs(node.ID)
+		if err != nil {
+			t.Fatalf("NUMA node %d: unexpected error: %v", node.ID, err)
+		}
+		if cpus.String() != expectedCPUs[node.ID] {
+			t.Errorf("NUMA node %d: got cpus %v expected %v", node.ID, cpus, expectedCPUs[node.ID])
+		}
+		if !reflect.DeepEqual(node.Cores, expectedCores[node.ID]) {
+			t.Errorf("NUMA node %d: got cores %v expected %v", node.ID, node.Cores, expectedCores[node.ID])
+		}
+
+		memory := resource.MustParse("32768000Ki")
+		if node.Memory == nil || node.Memory.Cmp(memory) != 0 {
+			t.Errorf("NUMA node %d: got memory %v expected %v", node.ID, node.Memory, memory.String())
+		}
+
+		expectedHPs := []HugePages{
+			{Size: resource.MustParse("2Mi"), Count: 512},
+			{Size: resource.MustParse("1Gi"), Count: 2},
+		}
+		if len(node.HugePages) != len(expectedHPs) {
+			t.Fatalf("NUMA node %d: got hugepages %v expected %v", node.ID, node.HugePages, expectedHPs)
+		}
+		for idx, hp := range node.HugePages {
+			if hp.Size.Cmp(expectedHPs[idx].Size) != 0 || hp.Count != expectedHPs[idx].Count {
+				t.Errorf("NUMA node %d: got hugepages %v expected %v", node.ID, node.HugePages, expectedHPs)
+			}
+		}
+	}
+
+	if !mach.HasDistances() {
+		t.Fatalf("missing distances")
+	}
+	expectedDistances := [][]int{{10, 21}, {21, 10}}
+	for from, dists := range expectedDistances {
+		for to, expected := range dists {
+			dist, err := mach.Distance(from, to)
+			if err != nil || dist != expected {
+				t.Errorf("distance %d->%d: got %d (%v) expected %d", from, to, dist, err, expected)
+			}
+		}
+	}
+
+	// the device with numa_node -1 has no NUMA affinity and is skipped
+	expectedDevices := []Device{
+		{Resource: "pci/10de:1db6", ID: "0000:3b:00.0", NUMANode: 0},
+		{Resource: "pci/8086:154c", ID: "0000:d8:00.2", NUMANode: 1},
+	}
+	if !reflect.DeepEqual(mach.Devices, expectedDevices) {
+		t.Errorf("got devices %v expected %v", mach.Devices, expectedDevices)
+	}
+}
+
+func TestFromSysfsRootWithSys(t *testing.T) {
+	dir := t.TempDir()
+	copySysfsFixture(t, filepath.Join(dir, "sys"))
+
+	mach, err := FromSysfs(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := mach.NodeIDs(); !reflect.DeepEqual(ids, []int{0, 1}) {
+		t.Errorf("unexpected NUMA nodes: %v", ids)
+	}
+}
+
+func TestFromSysfsMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	copySysfsFixture(t, dir)
+	for _, name := range []string{"node0/distance", "node1/distance", "node1/meminfo"} {
+		if err := os.Remove(filepath.Join(dir, "devices", "system", "node", name)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, "bus", "pci", "devices", "0000:d8:00.2", "numa_node")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mach, err := FromSysfs(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mach.HasDistances() {
+		t.Errorf("unexpected distances: %v %v", mach.NUMANodes[0].Distances, mach.NUMANodes[1].Distances)
+	}
+	if mach.NUMANodes[1].Memory != nil {
+		t.Errorf("unexpected memory for NUMA node 1: %v", mach.NUMANodes[1].Memory)
+	}
+	if len(mach.Devices) != 1 || mach.Devices[0].ID != "0000:3b:00.0" {
+		t.Errorf("unexpected devices: %v", mach.Devices)
+	}
+}
+
+func TestFromSysfsErrors(t *testing.T) {
+	type testCase struct {
+		name  string
+		file  string
+		value string
+	}
+
+	testCases := []testCase{
+		{name: "bad cpulist", file: "devices/system/node/node0/cpulist", value: "0-"},
+		{name: "bad distance", file: "devices/system/node/node0/distance", value: "10 far"},
+		{name: "missing distance", file: "devices/system/node/node1/distance", value: "10"},
+		{name: "bad hugepages", file: "devices/system/node/node0/hugepages/hugepages-2048kB/nr_hugepages", value: "many"},
+		{name: "bad numa_node", file: "bus/pci/devices/0000:3b:00.0/numa_node", value: "zero"},
+		{name: "device on unknown NUMA node", file: "bus/pci/devices/0000:3b:00.0/numa_node", value: "3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			copySysfsFixture(t, dir)
+			if err := os.WriteFile(filepath.Join(dir, tc.file), []byte(tc.value+"\n"), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if mach, err := FromSysfs(dir); err == nil {
+				t.Errorf("expected error, got %v", mach)
+			}
+		})
+	}
+
+	if _, err := FromSysfs(t.TempDir()); err == nil {
+		t.Errorf("expected error on an empty sysfs tree")
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package pod
+
+import (
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+)
+
+/*
+A pod file describes a pod and the hints the hint providers report for it, in YAML or JSON format:
+
+name: gpu-workload
+namespace: default                      # optional
+initContainers:
+- name: setup
+  hints:
+  - "cpu:[{01 true} {10 true} {11 false}]"
+containers:
+- name: app
+  hints:
+  - "cpu:[{01 true} {10 true} {11 false}]"
+  - "devicemanager:nvidia.com/gpu:[{10 true} {11 false}]"
+  allocateErrors:                       # optional, make Allocate fail after the merge
+    devicemanager: "requested number of devices unavailable for nvidia.com/gpu. Requested: 1, Available: 0"
+podHints:                               # the hints of the whole pod, used by the pod scope
+- "cpu:[{10 true} {11 false}]"
+- "devicemanager:nvidia.com/gpu:[{10 true} {11 false}]"
+
+hints are in the go format. The container scope asks the providers the hints of each container
+(GetTopologyHints), the pod scope the hints of the whole pod (GetPodTopologyHints): the providers
+compute the latter from the pod requests, so they must be given explicitly.
+A provider which has no hints for a container or for the pod reports no hints at all (empty map).
+A provider listed in allocateErrors fails to allocate the resources of the container with the given message,
+like the kubelet resource managers do when the resources run out between the merge and the allocation.
+*/
+
+const DefaultNamespace = "default"
+
+type Container struct {
+	Name  string   `json:"name"`
+	Hints []string `json:"hints,omitempty"`
+	// AllocateErrors are the errors the hint providers return allocating the resources of the container, by provider name
+	AllocateErrors map[string]string `json:"allocateErrors,omitempty"`
+}
+
+type Pod struct {
+	Name           string      `json:"name"`
+	Namespace      string      `json:"namespace,omitempty"`
+	InitContainers []Container `json:"initContainers,omitempty"`
+	Containers     []Container `json:"containers"`
+	PodHints       []string    `json:"podHints,omitempty"`
+}
+
+func Load(path string) (*Pod, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Pod, error) {
+	var pd Pod
+	err := yaml.UnmarshalStrict(data, &pd)
+	if err != nil {
+		return nil, err
+	}
+	if pd.Namespace == "" {
+		pd.Namespace = DefaultNamespace
+	}
+	return &pd, pd.Validate()
+}
+
+func (pd *Pod) Validate() error {
+	if pd.Name == "" {
+		return fmt.Errorf("missing pod name")
+	}
+	if len(pd.Containers) == 0 {
+		return fmt.Errorf("pod %q: no containers", pd.Name)
+	}
+	seen := make(map[string]bool)
+	for _, cnt := range pd.AllContainers() {
+		if cnt.Name == "" {
+			return fmt.Errorf("pod %q: missing container name", pd.Name)
+		}
+		if seen[cnt.Name] {
+			return fmt.Errorf("pod %q: duplicate container %q", pd.Name, cnt.Name)
+		}
+		seen[cnt.Name] = true
+		if _, err := cnt.ProviderHints(); err != nil {
+			return fmt.Errorf("pod %q container %q: %w", pd.Name, cnt.Name, err)
+		}
+		if _, ok := cnt.AllocateErrors[""]; ok {
+			return fmt.Errorf("pod %q container %q: missing provider name in allocateErrors", pd.Name, cnt.Name)
+		}
+	}
+	if _, err := pd.ProviderHints(); err != nil {
+		return fmt.Errorf("pod %q: %w", pd.Name, err)
+	}
+	return nil
+}
+
+// AllContainers returns the init containers followed by the app containers, in the order the kubelet admits them
+func (pd *Pod) AllContainers() []Container {
+	return append(append([]Container{}, pd.InitContainers...), pd.Containers...)
+}
+
+// IsInit tells if the given container is an init container
+func (pd *Pod) IsInit(name string) bool {
+	for _, cnt := range pd.InitContainers {
+		if cnt.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ProviderHints returns the hints of the container, grouped by provider
+func (cnt Container) ProviderHints() ([]tmhints.ProviderHints, error) {
+	return tmhints.ParseGO(cnt.Hints)
+}
+
+// ProviderHints returns the hints of the whole pod, grouped by provider
+func (pd *Pod) ProviderHints() ([]tmhints.ProviderHints, error) {
+	return tmhints.ParseGO(pd.PodHints)
+}
+
+// UID is the synthetic UID of the pod, stable across runs
+func (pd *Pod) UID() types.UID {
+	return types.UID(fmt.Sprintf("tmpolx-%s-%s", pd.Namespace, pd.Name))
+}
+
+// ToV1 builds the minimal v1.Pod the topology manager needs: the containers have no
+// resource requests because the hints come from the pod file and not from the providers.
+func (pd *Pod) ToV1() *v1.Pod {
+	toV1 := func(cnts []Container) []v1.Container {
+		var ret []v1.Container
+		for _, cnt := range cnts {
+			ret = append(ret, v1.Container{Name: cnt.Name})
+		}
+		return ret
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pd.Name,
+			Namespace: pd.Namespace,
+			UID:       pd.UID(),
+		},
+		Spec: v1.PodSpec{
+			InitContainers: toV1(pd.InitContainers),
+			Containers:     toV1(pd.Containers),
+		},
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package pod
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	type testCase struct {
+		name string
+		data string
+		// expectedErr is a substring of the expected error, empty if the pod is valid
+		expectedErr string
+	}
+
+	testCases := []testCase{
+		{
+			name: "hints for both the containers and the pod",
+			data: `
+name: gpu-workload
+containers:
+- name: app
+  hints:
+  - "cpumanager:cpu:[{01 true} {10 true} {11 false}]"
+podHints:
+- "cpumanager:cpu:[{10 true} {11 false}]"
+`,
+		},
+		{
+			// a provider which only fails to allocate reports no hints
+			name: "allocateErrors naming a provider with no hints",
+			data: `
+name: gpu-workload
+containers:
+- name: app
+  hints:
+  - "cpumanager:cpu:[{01 true}]"
+  allocateErrors:
+    devicemanager: "requested number of devices unavailable"
+`,
+		},
+		{
+			name: "duplicate container names",
+			data: `
+name: gpu-workload
+initContainers:
+- name: app
+containers:
+- name: app
+`,
+			expectedErr: `duplicate container "app"`,
+		},
+		{
+			name: "allocateErrors with no provider name",
+			data: `
+name: gpu-workload
+containers:
+- name: app
+  allocateErrors:
+    "": "requested number of devices unavailable"
+`,
+			expectedErr: "missing provider name",
+		},
+		{
+			name:        "missing pod name",
+			data:        "containers:\n- name: app\n",
+			expectedErr: "missing pod name",
+		},
+		{
+			name:        "no containers",
+			data:        "name: gpu-workload\ninitContainers:\n- name: setup\n",
+			expectedErr: "no containers",
+		},
+		{
+			name:        "missing container name",
+			data:        "name: gpu-workload\ncontainers:\n- hints: []\n",
+			expectedErr: "missing container name",
+		},
+		{
+			name:        "malformed container hints",
+			data:        "name: gpu-workload\ncontainers:\n- name: app\n  hints:\n  - \"cpu:[{01 true}\"\n",
+			expectedErr: `container "app"`,
+		},
+		{
+			name:        "malformed pod hints",
+			data:        "name: gpu-workload\ncontainers:\n- name: app\npodHints:\n- \"cpu:[{01 maybe}]\"\n",
+			expectedErr: "hint argument #1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pd, err := Parse([]byte(tc.data))
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if pd.Namespace != DefaultNamespace {
+					t.Errorf("expected the default namespace, got %q", pd.Namespace)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestToV1(t *testing.T) {
+	pd, err := Parse([]byte(`
+name: gpu-workload
+namespace: ml
+initContainers:
+- name: setup
+- name: warmup
+containers:
+- name: app
+- name: sidecar
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := func(cnts []Container) []string {
+		var ret []string
+		for _, cnt := range cnts {
+			ret = append(ret, cnt.Name)
+		}
+		return ret
+	}
+	if got := names(pd.AllContainers()); !reflect.DeepEqual(got, []string{"setup", "warmup", "app", "sidecar"}) {
+		t.Errorf("the init containers must come first, in order: got %v", got)
+	}
+	if !pd.IsInit("warmup") || pd.IsInit("app") {
+		t.Errorf("unexpected init containers")
+	}
+
+	v1pod := pd.ToV1()
+	if v1pod.Name != "gpu-workload" || v1pod.Namespace != "ml" || v1pod.UID != pd.UID() {
+		t.Errorf("unexpected pod metadata: %v", v1pod.ObjectMeta)
+	}
+	var initNames, appNames []string
+	for _, cnt := range v1pod.Spec.InitContainers {
+		initNames = append(initNames, cnt.Name)
+	}
+	for _, cnt := range v1pod.Spec.Containers {
+		appNames = append(appNames, cnt.Name)
+	}
+	if !reflect.DeepEqual(initNames, []string{"setup", "warmup"}) || !reflect.DeepEqual(appNames, []string{"app", "sidecar"}) {
+		t.Errorf("unexpected containers: init %v app %v", initNames, appNames)
+	}
+}
@@ -0,0 +1,256 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"sigs.k8s.io/yaml"
+
+	"github.com/fromanirh/tmpolx/pkg/cpumanager"
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+	"github.com/fromanirh/tmpolx/pkg/machine"
+	"github.com/fromanirh/tmpolx/pkg/tmpolx"
+)
+
+/*
+A scenario file holds one or more scenarios, in YAML or JSON format:
+
+scenarios:
+- name: gpu and sriov device on different NUMA nodes
+  numaNodes: "0-1"
+  policy: restricted
+  scope: container
+  lenient: false
+  hints:
+  - "cpu:[{01 true} {10 true} {11 false}]"
+  providers:
+  - name: devicemanager
+    hints:
+    - "nvidia.com/gpu:[{01 true} {11 false}]"
+    - "openshift.io/intelsriov:[{10 true} {11 false}]"
+  expected:
+    admit: false
+    hint: "{01 false}"
+
+numaNodes can be omitted if the scenario has a "machine" topology, see the machine package.
+policy and scope default to the ones of the machine topology, if any. A scenario merges a single set of hints,
+which both scopes merge the same way for a single container pod: the scope is validated and reported in the result.
+policyOptions are set like the kubelet topologyManagerPolicyOptions, e.g. prefer-closest-numa-nodes: "true";
+with the best-effort and restricted policies that option needs a machine topology with the NUMA distances.
+cpuRequest generates the cpu hints like the static CPU manager policy, from the machine topology, e.g.
+  cpuRequest: {cpus: 4, available: "2-15", reserved: "0-1"}
+hints are in the go format. The hints listed in a provider can't name another provider;
+a provider with no hints reported no hints at all (empty map).
+*/
+
+type File struct {
+	Scenarios []Scenario `json:"scenarios"`
+}
+
+type Provider struct {
+	Name  string   `json:"name"`
+	Hints []string `json:"hints,omitempty"`
+}
+
+type Expected struct {
+	Admit *bool  `json:"admit,omitempty"`
+	Hint  string `json:"hint,omitempty"`
+}
+
+type Scenario struct {
+	Name      string `json:"name"`
+	NUMANodes string `json:"numaNodes,omitempty"`
+	Policy    string `json:"policy,omitempty"`
+	// PolicyOptions are the TM policy options, see tmpolx.PolicyOptions
+	PolicyOptions map[string]string `json:"policyOptions,omitempty"`
+	Scope         string            `json:"scope,omitempty"`
+	Lenient       bool              `json:"lenient,omitempty"`
+	Hints         []string          `json:"hints,omitempty"`
+	Providers     []Provider        `json:"providers,omitempty"`
+	Expected      *Expected         `json:"expected,omitempty"`
+	// Machine is the machine topology, in the same format of the machine topology files
+	Machine *machine.Machine `json:"machine,omitempty"`
+	// CPURequest generates the cpu hints of the CPU manager from the machine topology
+	CPURequest *cpumanager.Request `json:"cpuRequest,omitempty"`
+}
+
+func Load(path string) ([]Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) ([]Scenario, error) {
+	var sf File
+	err := yaml.UnmarshalStrict(data, &sf)
+	if err != nil {
+		return nil, err
+	}
+	for idx, sc := range sf.Scenarios {
+		if sc.Name == "" {
+			sf.Scenarios[idx].Name = fmt.Sprintf("scenario #%d", idx+1)
+		}
+	}
+	return sf.Scenarios, nil
+}
+
+func (sc Scenario) ToParams() (tmpolx.Params, error) {
+	params := tmpolx.Params{
+		PolicyName:    sc.Policy,
+		PolicyOptions: sc.PolicyOptions,
+		ScopeName:     sc.Scope,
+		RawHints:      sc.Hints,
+		Lenient:       sc.Lenient,
+		Machine:       sc.Machine,
+		CPURequest:    sc.CPURequest,
+	}
+	if sc.Machine != nil {
+		if params.PolicyName == "" {
+			params.PolicyName = sc.Machine.Policy
+		}
+		if params.ScopeName == "" {
+			params.ScopeName = sc.Machine.Scope
+		}
+	}
+	if params.PolicyName == "" {
+		params.PolicyName = topologymanager.PolicyNone
+	}
+
+	if sc.NUMANodes == "" && sc.Machine == nil {
+		return params, fmt.Errorf("missing NUMA configuration")
+	}
+	numaConf, err := cpuset.Parse(sc.NUMANodes)
+	if err != nil {
+		return params, fmt.Errorf("bad format for NUMA configuration: %w", err)
+	}
+	params.NUMANodes = numaConf.ToSlice()
+
+	var rhs []tmhints.ResHints
+	for _, prov := range sc.Providers {
+		if prov.Name == "" {
+			return params, fmt.Errorf("missing provider name")
+		}
+		if len(prov.Hints) == 0 {
+			rhs = append(rhs, tmhints.ResHints{Provider: prov.Name})
+			continue
+		}
+		for idx, rawHint := range prov.Hints {
+			rh, err := tmhints.ParseGOResHints(idx+1, rawHint)
+			if err != nil {
+				return params, fmt.Errorf("provider %q: %w", prov.Name, err)
+			}
+			if rh.Provider != "" {
+				return params, fmt.Errorf("provider %q: hint argument #%d %q names provider %q", prov.Name, idx+1, rawHint, rh.Provider)
+			}
+			rh.Provider = prov.Name
+			rhs = append(rhs, rh)
+		}
+	}
+	params.ProviderHints, err = tmhints.Collect(rhs)
+	return params, err
+}
+
+type Result struct {
+	Name    string
+	Hint    topologymanager.TopologyHint
+	Admit   bool
+	Checked bool
+	// Error is why the scenario couldn't run; the scenario failed
+	Error    string
+	Failures []string
+}
+
+// Broken returns the failed result of a scenario which couldn't run
+func (sc Scenario) Broken(err error) Result {
+	return Result{
+		Name:     sc.Name,
+		Checked:  true,
+		Error:    err.Error(),
+		Failures: []string{err.Error()},
+	}
+}
+
+func (res Result) Passed() bool {
+	return len(res.Failures) == 0
+}
+
+func (res Result) String() string {
+	status := "----"
+	if res.Checked {
+		status = "PASS"
+		if !res.Passed() {
+			status = "FAIL"
+		}
+	}
+	if res.Error != "" {
+		return fmt.Sprintf("%s %s: error: %s", status, res.Name, res.Error)
+	}
+	line := fmt.Sprintf("%s %s: admit=%v hint=%v", status, res.Name, res.Admit, res.Hint)
+	if !res.Passed() {
+		line += ": " + strings.Join(res.Failures, ", ")
+	}
+	return line
+}
+
+func (sc Scenario) NewTMPolx() (*tmpolx.TMPolx, error) {
+	params, err := sc.ToParams()
+	if err != nil {
+		return nil, err
+	}
+	return tmpolx.NewFromParams(params)
+}
+
+// Check compares the result with the expected one. A malformed expected hint fails the scenario.
+func (sc Scenario) Check(bestHint topologymanager.TopologyHint, admit bool) Result {
+	res := Result{
+		Name:  sc.Name,
+		Hint:  bestHint,
+		Admit: admit,
+	}
+	if sc.Expected == nil {
+		return res
+	}
+
+	res.Checked = true
+	if sc.Expected.Admit != nil && *sc.Expected.Admit != admit {
+		res.Failures = append(res.Failures, fmt.Sprintf("expected admit=%v", *sc.Expected.Admit))
+	}
+	if sc.Expected.Hint != "" {
+		expHint, err := parseExpectedHint(sc.Expected.Hint)
+		if err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("bad expected hint: %v", err))
+		} else if !expHint.IsEqual(bestHint) {
+			res.Failures = append(res.Failures, fmt.Sprintf("expected hint=%v", expHint))
+		}
+	}
+	return res
+}
+
+func parseExpectedHint(rawHint string) (topologymanager.TopologyHint, error) {
+	ht, err := tmhints.ParseGOHint(1, rawHint)
+	if err != nil {
+		return topologymanager.TopologyHint{}, err
+	}
+	return ht.ToTM()
+}
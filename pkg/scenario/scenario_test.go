@@ -0,0 +1,196 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package scenario
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testScenarios = `
+scenarios:
+- name: expected to pass
+  numaNodes: "0-1"
+  policy: restricted
+  scope: pod
+  hints:
+  - "cpu:[{01 true} {10 true} {11 false}]"
+  providers:
+  - name: devicemanager
+    hints:
+    - "nvidia.com/gpu:[{01 true} {11 false}]"
+  expected:
+    admit: true
+    hint: "{01 true}"
+- name: expected to fail
+  numaNodes: "0-1"
+  policy: restricted
+  hints:
+  - "cpu:[{01 true} {10 true} {11 false}]"
+  - "nvidia.com/gpu:[{11 true}]"
+  expected:
+    admit: true
+    hint: "{01 true}"
+- name: malformed expected hint
+  numaNodes: "0-1"
+  policy: restricted
+  hints:
+  - "cpu:[{01 true}]"
+  expected:
+    hint: "{01 maybe}"
+- name: provider with no hints
+  numaNodes: "0-1"
+  policy: single-numa-node
+  hints:
+  - "cpu:[{01 true} {10 true} {11 false}]"
+  providers:
+  - name: memorymanager
+  expected:
+    admit: true
+    hint: "{01 true}"
+- numaNodes: "0-1"
+  policy: restricted
+`
+
+func TestParse(t *testing.T) {
+	scenarios, err := Parse([]byte(testScenarios))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scenarios) != 5 {
+		t.Fatalf("expected 5 scenarios, got %d", len(scenarios))
+	}
+	if scenarios[4].Name != "scenario #5" {
+		t.Errorf("unexpected default name: %q", scenarios[4].Name)
+	}
+
+	if _, err := Parse([]byte("scenarios:\n- name: unknown field\n  policies: restricted\n")); err == nil {
+		t.Errorf("expected error for an unknown field")
+	}
+}
+
+func TestRun(t *testing.T) {
+	scenarios, err := Parse([]byte(testScenarios))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type testCase struct {
+		name    string
+		passed  bool
+		checked bool
+		// failure is a substring of the failures, if any
+		failure string
+	}
+
+	testCases := []testCase{
+		{name: "expected to pass", passed: true, checked: true},
+		{name: "expected to fail", checked: true, failure: "expected admit=true"},
+		{name: "malformed expected hint", checked: true, failure: "bad expected hint"},
+		{name: "provider with no hints", passed: true, checked: true},
+		{name: "scenario #5", passed: true},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := scenarios[idx]
+			if sc.Name != tc.name {
+				t.Fatalf("expected scenario %q, got %q", tc.name, sc.Name)
+			}
+			tmpx, err := sc.NewTMPolx()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			bestHint, admit := tmpx.Merge()
+			res := sc.Check(bestHint, admit)
+			if res.Passed() != tc.passed || res.Checked != tc.checked {
+				t.Errorf("expected passed=%v checked=%v, got %s", tc.passed, tc.checked, res.String())
+			}
+			if tc.failure != "" && !strings.Contains(strings.Join(res.Failures, ", "), tc.failure) {
+				t.Errorf("expected failure %q, got %v", tc.failure, res.Failures)
+			}
+		})
+	}
+}
+
+func TestToParams(t *testing.T) {
+	scenarios, err := Parse([]byte(testScenarios))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params, err := scenarios[0].ToParams()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.ScopeName != "pod" {
+		t.Errorf("expected the pod scope, got %q", params.ScopeName)
+	}
+	if len(params.ProviderHints) != 1 || params.ProviderHints[0].Name != "devicemanager" {
+		t.Errorf("unexpected provider hints: %v", params.ProviderHints)
+	}
+
+	params, err = scenarios[3].ToParams()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(params.ProviderHints) != 1 || params.ProviderHints[0].Name != "memorymanager" || len(params.ProviderHints[0].Hints) != 0 {
+		t.Errorf("expected the memorymanager provider with no hints, got %v", params.ProviderHints)
+	}
+}
+
+func TestToParamsErrors(t *testing.T) {
+	type testCase struct {
+		name string
+		sc   Scenario
+	}
+
+	testCases := []testCase{
+		{name: "missing NUMA configuration", sc: Scenario{Policy: "restricted"}},
+		{name: "bad NUMA configuration", sc: Scenario{NUMANodes: "0-"}},
+		{name: "missing provider name", sc: Scenario{NUMANodes: "0-1", Providers: []Provider{{Hints: []string{"cpu:[{01 true}]"}}}}},
+		{name: "malformed provider hints", sc: Scenario{NUMANodes: "0-1", Providers: []Provider{{Name: "cpumanager", Hints: []string{"cpu:[{01 true}"}}}}},
+		{
+			name: "provider hints naming another provider",
+			sc:   Scenario{NUMANodes: "0-1", Providers: []Provider{{Name: "cpumanager", Hints: []string{"devicemanager:gpu:[{01 true}]"}}}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.sc.ToParams(); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+
+	// ToParams accepts the scope, NewFromParams validates it
+	if _, err := (Scenario{NUMANodes: "0-1", Scope: "node"}).NewTMPolx(); err == nil {
+		t.Errorf("expected error for an unknown scope")
+	}
+}
+
+func TestBroken(t *testing.T) {
+	res := Scenario{Name: "broken"}.Broken(errors.New("bad hints"))
+	if res.Passed() || !res.Checked {
+		t.Errorf("a broken scenario must fail, got %s", res.String())
+	}
+	if got := res.String(); got != "FAIL broken: error: bad hints" {
+		t.Errorf("unexpected result: %q", got)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"sigs.k8s.io/yaml"
+)
+
+const PolicyAll = "all"
+
+// AllPolicies lists the TM policies, from the most to the least permissive
+var AllPolicies = []string{
+	topologymanager.PolicyNone,
+	topologymanager.PolicyBestEffort,
+	topologymanager.PolicyRestricted,
+	topologymanager.PolicySingleNumaNode,
+}
+
+// ParsePolicies parses either "all" or a comma separated list of policy names
+func ParsePolicies(s string) ([]string, error) {
+	if s == PolicyAll {
+		return append([]string(nil), AllPolicies...), nil
+	}
+	var policies []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, policy := range AllPolicies {
+			if name == policy {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown policy: %q", name)
+		}
+		for _, policy := range policies {
+			if name == policy {
+				return nil, fmt.Errorf("duplicate policy: %q", name)
+			}
+		}
+		policies = append(policies, name)
+	}
+	return policies, nil
+}
+
+// Comparison holds the results of the same hints evaluated by many policies
+type Comparison struct {
+	Results []Result `json:"results"`
+}
+
+// Compare evaluates the hints with each of the given policies. params.PolicyName is ignored.
+func Compare(params Params, policies []string) (Comparison, error) {
+	var cmp Comparison
+	for _, policy := range policies {
+		params.PolicyName = policy
+		tmpx, err := NewFromParams(params)
+		if err != nil {
+			return cmp, err
+		}
+		cmp.Results = append(cmp.Results, tmpx.Run())
+	}
+	return cmp, nil
+}
+
+func (cmp Comparison) columns(res Result) []string {
+	return []string{
+		res.Policy,
+		res.masks.Mask(res.Hint.NUMANodeAffinity),
+		strconv.FormatBool(res.Hint.Preferred),
+		strconv.FormatBool(res.Admit),
+	}
+}
+
+// Disagreements returns the names of the columns on which the policies disagree
+func (cmp Comparison) Disagreements() []string {
+	names := []string{"", "hint", "preferred", "admit"}
+	var ret []string
+	for col := 1; col < len(names); col++ {
+		for _, res := range cmp.Results {
+			if cmp.columns(res)[col] != cmp.columns(cmp.Results[0])[col] {
+				ret = append(ret, names[col])
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// String renders the comparison as table. The columns the policies disagree on are marked with "*".
+func (cmp Comparison) String() string {
+	disagree := make(map[string]bool)
+	for _, name := range cmp.Disagreements() {
+		disagree[name] = true
+	}
+	header := []string{"policy", "hint", "preferred", "admit"}
+	for idx, name := range header {
+		if disagree[name] {
+			header[idx] = name + "*"
+		}
+	}
+
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t\n", strings.Join(header, "\t"))
+	for _, res := range cmp.Results {
+		fmt.Fprintf(tw, "%s\t\n", strings.Join(cmp.columns(res), "\t"))
+	}
+	tw.Flush()
+
+	for _, name := range cmp.Disagreements() {
+		var items []string
+		for _, res := range cmp.Results {
+			items = append(items, fmt.Sprintf("%s=%s", res.Policy, cmp.columns(res)[indexOf(header, name)]))
+		}
+		fmt.Fprintf(&buf, "* policies disagree on %s: %s\n", name, strings.Join(items, " "))
+	}
+	return buf.String()
+}
+
+func indexOf(header []string, name string) int {
+	for idx, item := range header {
+		if strings.TrimSuffix(item, "*") == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Render renders the comparison in the given output format
+func (cmp Comparison) Render(format string) (string, error) {
+	switch format {
+	case OutputText:
+		return cmp.String(), nil
+	case OutputJSON:
+		data, err := json.MarshalIndent(cmp, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	case OutputYAML:
+		data, err := yaml.Marshal(cmp)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("unknown output format: %q", format)
+}
@@ -0,0 +1,36 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePoliciesAllIsACopy(t *testing.T) {
+	policies, err := ParsePolicies(PolicyAll)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(policies, AllPolicies) {
+		t.Fatalf("expected %v, got %v", AllPolicies, policies)
+	}
+	policies[0] = "changed"
+	if AllPolicies[0] == "changed" {
+		t.Errorf("changing the parsed policies changed AllPolicies")
+	}
+}
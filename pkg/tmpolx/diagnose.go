@@ -0,0 +1,345 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
+)
+
+/*
+The restricted and single-numa-node policies admit only if the best hint is preferred. A merged hint is
+preferred only if all the hints in the permutation are preferred and have the same NUMA affinity
+(hints with no affinity match everything), so a rejection means there is no NUMA affinity every resource
+has a preferred hint for. single-numa-node considers only the preferred hints on a single NUMA node.
+*/
+
+// Blocker is a resource which prevents the admission, or a group of them
+type Blocker struct {
+	Resources  []string `json:"resources"`
+	Reason     string   `json:"reason"`
+	Suggestion string   `json:"suggestion,omitempty"`
+}
+
+type Diagnosis struct {
+	Policy   string    `json:"policy"`
+	Blockers []Blocker `json:"blockers"`
+}
+
+// preferredMasks are the NUMA affinities a resource has preferred hints for. any is true
+// if the resource has a preferred hint with no affinity, which merges with everything.
+type preferredMasks struct {
+	name  string
+	fh    FilteredHints
+	masks []bitmask.BitMask
+	any   bool
+}
+
+func (pm preferredMasks) intersect(masks []bitmask.BitMask) []bitmask.BitMask {
+	var ret []bitmask.BitMask
+	for _, mask := range masks {
+		if containsMask(pm.masks, mask) {
+			ret = append(ret, mask)
+		}
+	}
+	return ret
+}
+
+func containsMask(masks []bitmask.BitMask, mask bitmask.BitMask) bool {
+	for _, m := range masks {
+		if m.IsEqual(mask) {
+			return true
+		}
+	}
+	return false
+}
+
+func narrowestMask(masks []bitmask.BitMask) bitmask.BitMask {
+	var ret bitmask.BitMask
+	for _, mask := range masks {
+		if ret == nil || mask.IsNarrowerThan(ret) {
+			ret = mask
+		}
+	}
+	return ret
+}
+
+// Diagnose explains why the hints are rejected. Returns nil if the hints are admitted.
+func (tmpx *TMPolx) Diagnose() *Diagnosis {
+	policyName := tmpx.policy.Name()
+	if policyName != topologymanager.PolicyRestricted && policyName != topologymanager.PolicySingleNumaNode {
+		return nil
+	}
+	if _, admit := tmpx.Merge(); admit {
+		return nil
+	}
+
+	defaultAffinity, _ := bitmask.NewBitMask(tmpx.numaNodes...)
+	var resources []preferredMasks
+	for _, fh := range tmpx.filterHints() {
+		pm := preferredMasks{
+			name: fh.Provider + "/" + fh.Resource,
+			fh:   fh,
+		}
+		for _, hint := range fh.Hints {
+			if !hint.Preferred {
+				continue
+			}
+			if hint.NUMANodeAffinity == nil {
+				pm.any = true
+				continue
+			}
+			// the affinity is ANDed with the NUMA nodes while merging
+			mask := bitmask.And(defaultAffinity, hint.NUMANodeAffinity)
+			if !mask.IsEmpty() && !containsMask(pm.masks, mask) {
+				pm.masks = append(pm.masks, mask)
+			}
+		}
+		if !pm.any {
+			resources = append(resources, pm)
+		}
+	}
+
+	diag := &Diagnosis{
+		Policy: policyName,
+	}
+	for idx, pm := range resources {
+		if len(pm.masks) > 0 {
+			continue
+		}
+		reason := "no preferred hint"
+		if policyName == topologymanager.PolicySingleNumaNode {
+			reason = "no preferred hint on a single NUMA node"
+		}
+		diag.Blockers = append(diag.Blockers, Blocker{
+			Resources:  []string{pm.name},
+			Reason:     reason,
+			Suggestion: tmpx.suggest(pm, resources, idx),
+		})
+	}
+
+	var constraining []int
+	for idx, pm := range resources {
+		if len(pm.masks) > 0 {
+			constraining = append(constraining, idx)
+		}
+	}
+	for _, group := range tmpx.conflictingGroups(resources, constraining) {
+		var names, masks, suggestions []string
+		for _, idx := range group {
+			names = append(names, resources[idx].name)
+			masks = append(masks, tmpx.formatMasks(resources[idx].masks))
+			if sugg := tmpx.suggest(resources[idx], resources, idx); sugg != "" {
+				suggestions = append(suggestions, sugg)
+			}
+		}
+		reason := fmt.Sprintf("disjoint preferred masks %s and %s", masks[0], masks[1])
+		if len(group) > 2 {
+			reason = fmt.Sprintf("no preferred mask in common: %s and %s", strings.Join(masks[:len(masks)-1], ", "), masks[len(masks)-1])
+		}
+		diag.Blockers = append(diag.Blockers, Blocker{
+			Resources:  names,
+			Reason:     reason,
+			Suggestion: strings.Join(suggestions, " or "),
+		})
+	}
+
+	for _, idx := range constraining {
+		common, ok := commonMasks(resources, constraining, idx)
+		if !ok || len(common) == 0 {
+			continue
+		}
+		narrowest := narrowestMask(resources[idx].masks)
+		if narrowest.Count() <= widestCount(common) {
+			continue
+		}
+		diag.Blockers = append(diag.Blockers, Blocker{
+			Resources: []string{resources[idx].name},
+			Reason: fmt.Sprintf("the narrowest preferred hint %s is wider than every preferred mask the other resources have in common %s",
+				tmpx.masks.Mask(narrowest), tmpx.formatMasks(common)),
+			Suggestion: tmpx.suggest(resources[idx], resources, idx),
+		})
+	}
+
+	if len(diag.Blockers) == 0 {
+		// not expected: every rejection is either a resource with no preferred hint or a conflict
+		var names []string
+		for _, pm := range resources {
+			names = append(names, pm.name)
+		}
+		diag.Blockers = append(diag.Blockers, Blocker{
+			Resources: names,
+			Reason:    "no preferred merged hint",
+		})
+	}
+	return diag
+}
+
+// conflictingGroups returns the smallest groups of the given resources with no preferred mask in common,
+// which prevent any merged hint to be preferred. Returns nil if all the resources have a preferred mask in common.
+func (tmpx *TMPolx) conflictingGroups(resources []preferredMasks, indexes []int) [][]int {
+	for size := 2; size <= len(indexes); size++ {
+		var groups [][]int
+		iterateGroups(indexes, size, func(group []int) {
+			common := resources[group[0]].masks
+			for _, idx := range group[1:] {
+				common = resources[idx].intersect(common)
+			}
+			if len(common) == 0 {
+				groups = append(groups, append([]int{}, group...))
+			}
+		})
+		if len(groups) > 0 {
+			return groups
+		}
+	}
+	return nil
+}
+
+// iterateGroups calls the callback with all the groups of the given size of the given indexes, in order
+func iterateGroups(indexes []int, size int, callback func([]int)) {
+	var iterate func(start int, accum []int)
+	iterate = func(start int, accum []int) {
+		if len(accum) == size {
+			callback(accum)
+			return
+		}
+		for i := start; i < len(indexes); i++ {
+			iterate(i+1, append(accum, indexes[i]))
+		}
+	}
+	iterate(0, nil)
+}
+
+// commonMasks returns the preferred masks all the given resources but skip have in common.
+// ok is false if no other resource constrains the affinity.
+func commonMasks(resources []preferredMasks, indexes []int, skip int) ([]bitmask.BitMask, bool) {
+	var common []bitmask.BitMask
+	ok := false
+	for _, idx := range indexes {
+		if idx == skip {
+			continue
+		}
+		if !ok {
+			common = resources[idx].masks
+			ok = true
+			continue
+		}
+		common = resources[idx].intersect(common)
+	}
+	return common, ok
+}
+
+func widestCount(masks []bitmask.BitMask) int {
+	count := 0
+	for _, mask := range masks {
+		if mask.Count() > count {
+			count = mask.Count()
+		}
+	}
+	return count
+}
+
+// suggest finds the minimal change to the hints of a resource which makes the hints admitted:
+// a preferred hint with the narrowest affinity all the other resources have preferred hints for.
+func (tmpx *TMPolx) suggest(pm preferredMasks, resources []preferredMasks, idx int) string {
+	var candidates []bitmask.BitMask
+	constrained := false
+	for other, om := range resources {
+		if other == idx {
+			continue
+		}
+		if !constrained {
+			candidates = om.masks
+			constrained = true
+			continue
+		}
+		candidates = om.intersect(candidates)
+	}
+
+	var target bitmask.BitMask
+	if constrained {
+		target = narrowestMask(candidates)
+	} else {
+		// no other resource constrains the affinity: any NUMA node will do
+		if len(tmpx.numaNodes) > 0 {
+			target, _ = bitmask.NewBitMask(tmpx.numaNodes[0])
+		}
+		if nonPreferred := tmpx.narrowestNonPreferred(pm); nonPreferred != nil {
+			target = nonPreferred
+		}
+	}
+	if target == nil {
+		return ""
+	}
+
+	hint := topologymanager.TopologyHint{NUMANodeAffinity: target, Preferred: true}
+	for _, ht := range tmpx.origHints(pm.fh) {
+		if ht.NUMANodeAffinity != nil && ht.NUMANodeAffinity.IsEqual(target) {
+			return fmt.Sprintf("mark the hint %s of %s as preferred", tmpx.masks.Hint(ht), pm.name)
+		}
+	}
+	return fmt.Sprintf("add the hint %s to %s", tmpx.masks.Hint(hint), pm.name)
+}
+
+// narrowestNonPreferred returns the narrowest affinity the resource has a non-preferred hint for, if it is allowed by the policy
+func (tmpx *TMPolx) narrowestNonPreferred(pm preferredMasks) bitmask.BitMask {
+	var masks []bitmask.BitMask
+	for _, ht := range tmpx.origHints(pm.fh) {
+		if ht.NUMANodeAffinity == nil || ht.NUMANodeAffinity.IsEmpty() {
+			continue
+		}
+		if tmpx.policy.Name() == topologymanager.PolicySingleNumaNode && ht.NUMANodeAffinity.Count() != 1 {
+			continue
+		}
+		masks = append(masks, ht.NUMANodeAffinity)
+	}
+	return narrowestMask(masks)
+}
+
+// origHints returns the hints as reported by the provider, before the policy filtered them
+func (tmpx *TMPolx) origHints(fh FilteredHints) []topologymanager.TopologyHint {
+	for _, ph := range tmpx.providers {
+		if ph.Name == fh.Provider {
+			return ph.Hints[fh.Resource]
+		}
+	}
+	return nil
+}
+
+func (tmpx *TMPolx) formatMasks(masks []bitmask.BitMask) string {
+	items := make([]string, 0, len(masks))
+	for _, mask := range masks {
+		items = append(items, tmpx.masks.Mask(mask))
+	}
+	return "[" + strings.Join(items, " ") + "]"
+}
+
+func (diag Diagnosis) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "rejected by the %s policy:\n", diag.Policy)
+	for _, blk := range diag.Blockers {
+		fmt.Fprintf(&sb, "- %s: %s\n", strings.Join(blk.Resources, ", "), blk.Reason)
+		if blk.Suggestion != "" {
+			fmt.Fprintf(&sb, "  suggestion: %s\n", blk.Suggestion)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,138 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	type testCase struct {
+		name      string
+		policy    string
+		numaNodes []int
+		hints     []string
+		// expected are the resources of each blocker, nil if the hints are admitted
+		expected [][]string
+	}
+
+	testCases := []testCase{
+		{
+			name:      "admitted",
+			policy:    "restricted",
+			numaNodes: []int{0, 1},
+			hints:     []string{"cpu:[{01 true} {11 false}]", "memory:[{01 true}]"},
+		},
+		{
+			name:      "no preferred hint",
+			policy:    "restricted",
+			numaNodes: []int{0, 1},
+			hints:     []string{"cpu:[{01 true}]", "memory:[{11 false}]"},
+			expected:  [][]string{{"default/memory"}},
+		},
+		{
+			name:      "no preferred hint on a single NUMA node",
+			policy:    "single-numa-node",
+			numaNodes: []int{0, 1},
+			hints:     []string{"cpu:[{01 true}]", "memory:[{11 true}]"},
+			expected:  [][]string{{"default/memory"}},
+		},
+		{
+			name:      "disjoint pair",
+			policy:    "restricted",
+			numaNodes: []int{0, 1},
+			hints:     []string{"cpu:[{01 true} {10 true}]", "gpu:[{01 true}]", "nic:[{10 true}]"},
+			expected:  [][]string{{"default/gpu", "default/nic"}},
+		},
+		{
+			// every pair has a preferred mask in common, but no mask is preferred by all of them
+			name:      "pairwise overlapping",
+			policy:    "restricted",
+			numaNodes: []int{0, 1, 2},
+			hints: []string{
+				"a:[{001 true} {010 true} {111 false}]",
+				"b:[{010 true} {100 true} {111 false}]",
+				"c:[{001 true} {100 true} {111 false}]",
+			},
+			expected: [][]string{{"default/a", "default/b", "default/c"}},
+		},
+		{
+			name:      "narrowest hint wider than the common masks",
+			policy:    "restricted",
+			numaNodes: []int{0, 1, 2},
+			hints:     []string{"cpu:[{011 true}]", "gpu:[{001 true} {011 false}]", "nic:[{001 true} {111 true}]"},
+			expected:  [][]string{{"default/cpu", "default/gpu"}, {"default/cpu", "default/nic"}, {"default/cpu"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpx, err := NewFromParams(Params{
+				PolicyName: tc.policy,
+				NUMANodes:  tc.numaNodes,
+				RawHints:   tc.hints,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			diag := tmpx.Diagnose()
+			if tc.expected == nil {
+				if diag != nil {
+					t.Fatalf("unexpected diagnosis: %v", diag)
+				}
+				return
+			}
+			if diag == nil {
+				t.Fatalf("missing diagnosis")
+			}
+			var got [][]string
+			for _, blk := range diag.Blockers {
+				got = append(got, blk.Resources)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got blockers %v expected %v\n%s", got, tc.expected, diag.String())
+			}
+		})
+	}
+}
+
+// A rejection must always be explained
+func TestDiagnoseAlwaysFindsBlockers(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	for _, policy := range AllPolicies {
+		for iter := 0; iter < 2000; iter++ {
+			tmpx := newRandomTMPolx(t, rnd, policy, 2)
+			diag := tmpx.Diagnose()
+			if _, admit := tmpx.Merge(); admit != (diag == nil) {
+				t.Fatalf("admit=%v diagnosis=%v\n%s", admit, diag, tmpx.String())
+			}
+			if diag == nil {
+				continue
+			}
+			if len(diag.Blockers) == 0 {
+				t.Fatalf("rejected with no blockers\n%s", tmpx.String())
+			}
+			for _, blk := range diag.Blockers {
+				if blk.Reason == "no preferred merged hint" {
+					t.Fatalf("unexplained rejection\n%s", tmpx.String())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+)
+
+// The compareHints branches, named like in the TM sources comments
+const (
+	DecisionEmptyAffinity = "candidate has empty affinity"
+	DecisionFirst         = "first candidate"
+	DecisionPreferred     = "preferred over non-preferred"
+	DecisionNonPreferred  = "non-preferred never replaces preferred"
+	DecisionBothPreferred = "both preferred"
+	DecisionCase1         = "case 1"
+	DecisionCase2         = "case 2"
+	DecisionCase3a        = "case 3a"
+	DecisionCase3b        = "case 3b"
+	DecisionCase3ca       = "case 3ca"
+	DecisionCase3cb       = "case 3cb"
+	DecisionCase3cc       = "case 3cc"
+)
+
+// Step is the evaluation of one hint permutation
+type Step struct {
+	Permutation []topologymanager.TopologyHint
+	Merged      topologymanager.TopologyHint
+	Replaced    bool
+	Decision    string
+}
+
+// Explanation traces how the policy merged the hints
+type Explanation struct {
+	Policy string
+	// Filtered are the hints of each resource the permutations are made of
+	Filtered                      []FilteredHints
+	BestNonPreferredAffinityCount int
+	Steps                         []Step
+	// Fallback is true if no permutation was a valid candidate, so the default affinity was used
+	Fallback bool
+	// Notes are the policy specific adjustments to the merged hint
+	Notes    []string
+	BestHint topologymanager.TopologyHint
+	Admit    bool
+
+	masks tmhints.MaskFormatter
+}
+
+// replay merges the hints step by step, like the policy does
+func (tmpx *TMPolx) replay() Explanation {
+	exp := Explanation{
+		Policy: tmpx.policy.Name(),
+		masks:  tmpx.masks,
+	}
+
+	if exp.Policy == topologymanager.PolicyNone {
+		exp.Notes = append(exp.Notes, "the none policy doesn't merge hints and always admits")
+		exp.Admit = true
+	} else {
+		exp.Filtered = tmpx.filterHints()
+		exp.BestNonPreferredAffinityCount = maxOfMinAffinityCounts(exp.Filtered)
+
+		var bestHint *topologymanager.TopologyHint
+		iterateAllProviderTopologyHints(exp.Filtered, func(permutation []topologymanager.TopologyHint) {
+			mergedHint := mergePermutation(tmpx.numaNodes, permutation)
+			best, decision := tmpx.compareHints(exp.BestNonPreferredAffinityCount, bestHint, &mergedHint)
+			exp.Steps = append(exp.Steps, Step{
+				Permutation: append([]topologymanager.TopologyHint{}, permutation...),
+				Merged:      mergedHint,
+				Replaced:    best != bestHint,
+				Decision:    decision,
+			})
+			bestHint = best
+		})
+
+		defaultAffinity, _ := bitmask.NewBitMask(tmpx.numaNodes...)
+		if bestHint == nil {
+			exp.Fallback = true
+			bestHint = &topologymanager.TopologyHint{NUMANodeAffinity: defaultAffinity, Preferred: false}
+		}
+		exp.BestHint = *bestHint
+
+		switch exp.Policy {
+		case topologymanager.PolicyBestEffort:
+			exp.Admit = true
+		case topologymanager.PolicyRestricted:
+			exp.Admit = exp.BestHint.Preferred
+		case topologymanager.PolicySingleNumaNode:
+			if exp.BestHint.NUMANodeAffinity.IsEqual(defaultAffinity) {
+				exp.Notes = append(exp.Notes, "the single-numa-node policy reports the default affinity as no affinity")
+				exp.BestHint = topologymanager.TopologyHint{NUMANodeAffinity: nil, Preferred: exp.BestHint.Preferred}
+			}
+			exp.Admit = exp.BestHint.Preferred
+		}
+	}
+	return exp
+}
+
+// Explain replays the policy merge step by step, and cross-checks the outcome with the vendored policy.
+func (tmpx *TMPolx) Explain() (Explanation, error) {
+	exp := tmpx.replay()
+	if tmpx.preferClosest() {
+		exp.Notes = append(exp.Notes, fmt.Sprintf("the vendored %s policy doesn't support the %s option: not cross-checked", exp.Policy, PreferClosestNUMANodes))
+		return exp, nil
+	}
+
+	bestHint, admit := tmpx.Merge()
+	if !bestHint.IsEqual(exp.BestHint) || admit != exp.Admit {
+		return exp, fmt.Errorf("the explanation diverges from the %s policy: explained admit=%v hint=%s, policy admit=%v hint=%s",
+			exp.Policy, exp.Admit, tmpx.masks.Hint(exp.BestHint), admit, tmpx.masks.Hint(bestHint))
+	}
+	return exp, nil
+}
+
+func (exp Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "explaining policy %q\n", exp.Policy)
+	for idx, fh := range exp.Filtered {
+		res := fh.Resource
+		if res == "" {
+			res = "-"
+		}
+		fmt.Fprintf(&sb, "hints #%d: provider %q resource %q: %s\n", idx+1, fh.Provider, res, exp.masks.Hints(fh.Hints))
+	}
+	if exp.Policy != topologymanager.PolicyNone {
+		fmt.Fprintf(&sb, "bestNonPreferredAffinityCount=%d\n", exp.BestNonPreferredAffinityCount)
+	}
+	for idx, step := range exp.Steps {
+		verdict := "kept"
+		if step.Replaced {
+			verdict = "REPLACED"
+		}
+		fmt.Fprintf(&sb, "permutation #%d: %s -> merged %s: %s best (%s)\n", idx+1,
+			exp.masks.Hints(step.Permutation), exp.masks.Hint(step.Merged), verdict, step.Decision)
+	}
+	if exp.Fallback {
+		fmt.Fprintf(&sb, "no valid candidate: using the default affinity, non-preferred\n")
+	}
+	for _, note := range exp.Notes {
+		fmt.Fprintf(&sb, "%s\n", note)
+	}
+	fmt.Fprintf(&sb, "best hint %s admit=%v\n", exp.masks.Hint(exp.BestHint), exp.Admit)
+	return sb.String()
+}
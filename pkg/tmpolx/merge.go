@@ -0,0 +1,227 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"math"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
+)
+
+/*
+The functions in this file are a port of the (unexported) TM merge helpers in policy.go,
+and must be kept in sync with the vendored sources. They exist to make the merge process
+observable and, for the policy options the vendored TM lacks, to merge the hints (see options.go).
+Otherwise, the result is always cross-checked against the vendored policy.
+
+The one intended difference is the order of the permutations: TM visits the resources of each provider
+in map order, which is random, while the port visits them in a stable order. compareHints breaks ties
+by NUMA node ids, so the order doesn't change the best hint, but it does change the steps of --explain.
+merge_test.go checks the port against the vendored policies on random hints, and that every
+run of the vendored policies, whatever the map order, gives the same result of the port.
+*/
+
+// FilteredHints are the hints of a resource as the policy merges them.
+// Resource is empty if the provider reported no hints at all.
+type FilteredHints struct {
+	Provider string
+	Resource string
+	Hints    []topologymanager.TopologyHint
+}
+
+// filterHints mirrors filterProvidersHints and, for the single-numa-node policy, filterSingleNumaHints.
+// Unlike TM, the resources of each provider are visited in a stable order (see Params.SortResources), not in map order.
+func (tmpx *TMPolx) filterHints() []FilteredHints {
+	var allProviderHints []FilteredHints
+	for _, ph := range tmpx.providers {
+		if len(ph.Hints) == 0 {
+			allProviderHints = append(allProviderHints, FilteredHints{
+				Provider: ph.Name,
+				Hints:    []topologymanager.TopologyHint{{NUMANodeAffinity: nil, Preferred: true}},
+			})
+			continue
+		}
+		for _, res := range tmpx.resourceNames(ph) {
+			fh := FilteredHints{
+				Provider: ph.Name,
+				Resource: res,
+				Hints:    ph.Hints[res],
+			}
+			if fh.Hints == nil {
+				fh.Hints = []topologymanager.TopologyHint{{NUMANodeAffinity: nil, Preferred: true}}
+			} else if len(fh.Hints) == 0 {
+				fh.Hints = []topologymanager.TopologyHint{{NUMANodeAffinity: nil, Preferred: false}}
+			}
+			allProviderHints = append(allProviderHints, fh)
+		}
+	}
+
+	if tmpx.policy.Name() != topologymanager.PolicySingleNumaNode {
+		return allProviderHints
+	}
+	for idx, fh := range allProviderHints {
+		var filtered []topologymanager.TopologyHint
+		for _, hint := range fh.Hints {
+			if hint.NUMANodeAffinity == nil && hint.Preferred {
+				filtered = append(filtered, hint)
+			}
+			if hint.NUMANodeAffinity != nil && hint.NUMANodeAffinity.Count() == 1 && hint.Preferred {
+				filtered = append(filtered, hint)
+			}
+		}
+		allProviderHints[idx].Hints = filtered
+	}
+	return allProviderHints
+}
+
+// countPermutations returns how many hint permutations the policy evaluates, capped to math.MaxInt.
+// The none policy doesn't merge hints.
+func (tmpx *TMPolx) countPermutations() int {
+	if tmpx.policy.Name() == topologymanager.PolicyNone {
+		return 0
+	}
+	count := 1
+	for _, fh := range tmpx.filterHints() {
+		if len(fh.Hints) == 0 {
+			return 0
+		}
+		if count > math.MaxInt/len(fh.Hints) {
+			count = math.MaxInt
+			continue
+		}
+		count *= len(fh.Hints)
+	}
+	return count
+}
+
+func mergePermutation(numaNodes []int, permutation []topologymanager.TopologyHint) topologymanager.TopologyHint {
+	preferred := true
+	defaultAffinity, _ := bitmask.NewBitMask(numaNodes...)
+	var numaAffinities []bitmask.BitMask
+	for _, hint := range permutation {
+		if hint.NUMANodeAffinity != nil {
+			numaAffinities = append(numaAffinities, hint.NUMANodeAffinity)
+			if !hint.NUMANodeAffinity.IsEqual(numaAffinities[0]) {
+				preferred = false
+			}
+		}
+		if !hint.Preferred {
+			preferred = false
+		}
+	}
+	mergedAffinity := bitmask.And(defaultAffinity, numaAffinities...)
+	return topologymanager.TopologyHint{NUMANodeAffinity: mergedAffinity, Preferred: preferred}
+}
+
+func narrowestHint(hints []topologymanager.TopologyHint) *topologymanager.TopologyHint {
+	if len(hints) == 0 {
+		return nil
+	}
+	var narrowestHint *topologymanager.TopologyHint
+	for i := range hints {
+		if hints[i].NUMANodeAffinity == nil {
+			continue
+		}
+		if narrowestHint == nil {
+			narrowestHint = &hints[i]
+		}
+		if hints[i].NUMANodeAffinity.IsNarrowerThan(narrowestHint.NUMANodeAffinity) {
+			narrowestHint = &hints[i]
+		}
+	}
+	return narrowestHint
+}
+
+func maxOfMinAffinityCounts(filteredHints []FilteredHints) int {
+	maxOfMinCount := 0
+	for _, fh := range filteredHints {
+		narrowestHint := narrowestHint(fh.Hints)
+		if narrowestHint == nil {
+			continue
+		}
+		if narrowestHint.NUMANodeAffinity.Count() > maxOfMinCount {
+			maxOfMinCount = narrowestHint.NUMANodeAffinity.Count()
+		}
+	}
+	return maxOfMinCount
+}
+
+// compareHints mirrors the TM compareHints, and also tells which branch took the decision.
+// See the vendored sources for the rationale of each case.
+func (tmpx *TMPolx) compareHints(bestNonPreferredAffinityCount int, current *topologymanager.TopologyHint, candidate *topologymanager.TopologyHint) (*topologymanager.TopologyHint, string) {
+	if candidate.NUMANodeAffinity.Count() == 0 {
+		return current, DecisionEmptyAffinity
+	}
+	if current == nil {
+		return candidate, DecisionFirst
+	}
+	if !current.Preferred && candidate.Preferred {
+		return candidate, DecisionPreferred
+	}
+	if current.Preferred && !candidate.Preferred {
+		return current, DecisionNonPreferred
+	}
+	if current.Preferred && candidate.Preferred {
+		return tmpx.fitterDecision(current, candidate, DecisionBothPreferred)
+	}
+
+	if current.NUMANodeAffinity.Count() > bestNonPreferredAffinityCount {
+		return tmpx.fitterDecision(current, candidate, DecisionCase1)
+	}
+	if current.NUMANodeAffinity.Count() == bestNonPreferredAffinityCount {
+		if candidate.NUMANodeAffinity.Count() != bestNonPreferredAffinityCount {
+			return current, DecisionCase2
+		}
+		return tmpx.fitterDecision(current, candidate, DecisionCase2)
+	}
+	if candidate.NUMANodeAffinity.Count() > bestNonPreferredAffinityCount {
+		return current, DecisionCase3a
+	}
+	if candidate.NUMANodeAffinity.Count() == bestNonPreferredAffinityCount {
+		return candidate, DecisionCase3b
+	}
+	if candidate.NUMANodeAffinity.Count() > current.NUMANodeAffinity.Count() {
+		return candidate, DecisionCase3ca
+	}
+	if candidate.NUMANodeAffinity.Count() < current.NUMANodeAffinity.Count() {
+		return current, DecisionCase3cb
+	}
+	return tmpx.fitterDecision(current, candidate, DecisionCase3cc)
+}
+
+func (tmpx *TMPolx) fitterDecision(current, candidate *topologymanager.TopologyHint, decision string) (*topologymanager.TopologyHint, string) {
+	best, how := tmpx.fitterHint(current, candidate)
+	if how != "" {
+		decision += ", " + how
+	}
+	return best, decision
+}
+
+func iterateAllProviderTopologyHints(allProviderHints []FilteredHints, callback func([]topologymanager.TopologyHint)) {
+	var iterate func(i int, accum []topologymanager.TopologyHint)
+	iterate = func(i int, accum []topologymanager.TopologyHint) {
+		if i == len(allProviderHints) {
+			callback(accum)
+			return
+		}
+		for j := range allProviderHints[i].Hints {
+			iterate(i+1, append(accum, allProviderHints[i].Hints[j]))
+		}
+	}
+	iterate(0, []topologymanager.TopologyHint{})
+}
@@ -0,0 +1,129 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+)
+
+// randomHints returns nil (no preference), empty (no possible affinity) or random hints on the given NUMA nodes
+func randomHints(rnd *rand.Rand, numaNodes []int) []topologymanager.TopologyHint {
+	switch rnd.Intn(8) {
+	case 0:
+		return nil
+	case 1:
+		return []topologymanager.TopologyHint{}
+	}
+	hints := []topologymanager.TopologyHint{}
+	for count := 1 + rnd.Intn(4); count > 0; count-- {
+		var nodes []int
+		for _, node := range numaNodes {
+			if rnd.Intn(2) == 0 {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) == 0 {
+			nodes = append(nodes, numaNodes[rnd.Intn(len(numaNodes))])
+		}
+		mask, _ := bitmask.NewBitMask(nodes...)
+		hints = append(hints, topologymanager.TopologyHint{NUMANodeAffinity: mask, Preferred: rnd.Intn(2) == 0})
+	}
+	return hints
+}
+
+// randomProviders returns up to 3 providers, each reporting the hints of up to maxResources resources
+func randomProviders(rnd *rand.Rand, numaNodes []int, maxResources int) []tmhints.ProviderHints {
+	var providers []tmhints.ProviderHints
+	for prov := 0; prov < 1+rnd.Intn(3); prov++ {
+		ph := tmhints.ProviderHints{
+			Name:  fmt.Sprintf("provider%d", prov),
+			Hints: make(map[string][]topologymanager.TopologyHint),
+		}
+		// a provider may report no hints at all
+		for res := 0; res < rnd.Intn(maxResources+1); res++ {
+			name := fmt.Sprintf("resource%d", res)
+			ph.Hints[name] = randomHints(rnd, numaNodes)
+			ph.Resources = append(ph.Resources, name)
+		}
+		providers = append(providers, ph)
+	}
+	return providers
+}
+
+func newRandomTMPolx(t *testing.T, rnd *rand.Rand, policy string, maxResources int) *TMPolx {
+	t.Helper()
+	var numaNodes []int
+	for node := 0; node < 2+rnd.Intn(5); node++ {
+		numaNodes = append(numaNodes, node)
+	}
+	tmpx, err := NewFromParams(Params{
+		PolicyName:    policy,
+		NUMANodes:     numaNodes,
+		ProviderHints: randomProviders(rnd, numaNodes, maxResources),
+		Lenient:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return tmpx
+}
+
+// The port of the TM merge must give the same result of the vendored policies. With one resource
+// per provider the vendored policies visit the permutations in the same order of the port.
+func TestReplayMatchesThePolicies(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, policy := range AllPolicies {
+		t.Run(policy, func(t *testing.T) {
+			for iter := 0; iter < 5000; iter++ {
+				tmpx := newRandomTMPolx(t, rnd, policy, 1)
+				exp := tmpx.replay()
+				bestHint, admit := tmpx.policy.Merge(tmhints.ToProvidersHints(tmpx.providers))
+				if !bestHint.IsEqual(exp.BestHint) || admit != exp.Admit {
+					t.Fatalf("replay admit=%v hint=%v, policy admit=%v hint=%v\n%s", exp.Admit, exp.BestHint, admit, bestHint, tmpx.String())
+				}
+			}
+		})
+	}
+}
+
+// With many resources per provider the vendored policies visit the resources in map order, which is
+// random, while the port visits them in a stable order. The order must not change the result:
+// every run of the policy must give the result of the port.
+func TestReplayMatchesThePoliciesInAnyResourceOrder(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	for _, policy := range AllPolicies {
+		t.Run(policy, func(t *testing.T) {
+			for iter := 0; iter < 500; iter++ {
+				tmpx := newRandomTMPolx(t, rnd, policy, 3)
+				exp := tmpx.replay()
+				for run := 0; run < 20; run++ {
+					bestHint, admit := tmpx.policy.Merge(tmhints.ToProvidersHints(tmpx.providers))
+					if !bestHint.IsEqual(exp.BestHint) || admit != exp.Admit {
+						t.Fatalf("run #%d: replay admit=%v hint=%v, policy admit=%v hint=%v\n%s", run+1, exp.Admit, exp.BestHint, admit, bestHint, tmpx.String())
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+)
+
+/*
+RenderMap draws the NUMA nodes as columns of boxes, and for each hint the NUMA nodes it covers:
+
+                              +--------+--------+
+                              | node 0 | node 1 |
+                              +--------+--------+
+default/cpu         {01 true} |   P    |        |
+                    {10 true} |        |   P    |
+                   {11 false} |   n    |   n    |
+                              +--------+--------+
+best hint          {01 false} |  ###   |        |
+                              +--------+--------+
+*/
+
+const (
+	mapPreferred    = "P"
+	mapNonPreferred = "n"
+	mapAnyNode      = "-"
+	mapBestHint     = "###"
+)
+
+type mapRow struct {
+	label string
+	hint  string
+	cells []string
+	note  string
+}
+
+func (tmpx *TMPolx) mapCells(hint topologymanager.TopologyHint, mark string) []string {
+	cells := make([]string, len(tmpx.numaNodes))
+	for idx, node := range tmpx.numaNodes {
+		if hint.NUMANodeAffinity == nil {
+			cells[idx] = mapAnyNode
+		} else if hint.NUMANodeAffinity.IsSet(node) {
+			cells[idx] = mark
+		}
+	}
+	return cells
+}
+
+func (tmpx *TMPolx) mapHintRows(label string, hints []topologymanager.TopologyHint) []mapRow {
+	if hints == nil {
+		return []mapRow{{label: label, hint: tmpx.masks.Hints(hints), cells: tmpx.mapCells(topologymanager.TopologyHint{}, ""), note: "no preference"}}
+	}
+	if len(hints) == 0 {
+		return []mapRow{{label: label, hint: tmpx.masks.Hints(hints), cells: make([]string, len(tmpx.numaNodes)), note: "no possible affinity"}}
+	}
+	var rows []mapRow
+	for _, hint := range hints {
+		mark := mapNonPreferred
+		if hint.Preferred {
+			mark = mapPreferred
+		}
+		rows = append(rows, mapRow{label: label, hint: tmpx.masks.Hint(hint), cells: tmpx.mapCells(hint, mark)})
+		label = ""
+	}
+	return rows
+}
+
+// RenderMap renders the hints and the given best hint as an ASCII map of the NUMA nodes
+func (tmpx *TMPolx) RenderMap(bestHint topologymanager.TopologyHint) string {
+	var rows []mapRow
+	for _, ph := range tmpx.providers {
+		if len(ph.Hints) == 0 {
+			rows = append(rows, mapRow{label: ph.Name, hint: "map[]", cells: tmpx.mapCells(topologymanager.TopologyHint{}, ""), note: "no hints"})
+			continue
+		}
+		for _, res := range tmpx.resourceNames(ph) {
+			rows = append(rows, tmpx.mapHintRows(ph.Name+"/"+res, ph.Hints[res])...)
+		}
+	}
+	best := mapRow{label: "best hint", hint: tmpx.masks.Hint(bestHint), cells: tmpx.mapCells(bestHint, mapBestHint)}
+
+	// the header lists the NUMA nodes and, if the machine is known, their cpus
+	headers := [][]string{make([]string, len(tmpx.numaNodes))}
+	for idx, node := range tmpx.numaNodes {
+		headers[0][idx] = fmt.Sprintf("node %d", node)
+	}
+	if tmpx.machine != nil {
+		cpus := make([]string, len(tmpx.numaNodes))
+		for idx, node := range tmpx.numaNodes {
+			if nodeCPUs, err := tmpx.machine.NodeCPUs(node); err == nil && nodeCPUs.Size() > 0 {
+				cpus[idx] = "cpus " + nodeCPUs.String()
+			}
+		}
+		headers = append(headers, cpus)
+	}
+
+	cellWidth := len(mapBestHint)
+	for _, header := range headers {
+		for _, item := range header {
+			if len(item) > cellWidth {
+				cellWidth = len(item)
+			}
+		}
+	}
+	labelWidth, hintWidth := 0, 0
+	for _, row := range append(rows, best) {
+		if len(row.label) > labelWidth {
+			labelWidth = len(row.label)
+		}
+		if len(row.hint) > hintWidth {
+			hintWidth = len(row.hint)
+		}
+	}
+
+	var sb strings.Builder
+	indent := strings.Repeat(" ", labelWidth+1+hintWidth+1)
+	border := indent + "+" + strings.Repeat(strings.Repeat("-", cellWidth+2)+"+", len(tmpx.numaNodes)) + "\n"
+	writeCells := func(cells []string) {
+		sb.WriteString("|")
+		for _, cell := range cells {
+			pad := cellWidth - len(cell)
+			fmt.Fprintf(&sb, " %s%s%s |", strings.Repeat(" ", pad/2), cell, strings.Repeat(" ", pad-pad/2))
+		}
+	}
+	writeRow := func(row mapRow) {
+		fmt.Fprintf(&sb, "%-*s %*s ", labelWidth, row.label, hintWidth, row.hint)
+		writeCells(row.cells)
+		if row.note != "" {
+			fmt.Fprintf(&sb, " %s", row.note)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(border)
+	for _, header := range headers {
+		sb.WriteString(indent)
+		writeCells(header)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(border)
+	for _, row := range rows {
+		writeRow(row)
+	}
+	sb.WriteString(border)
+	writeRow(best)
+	sb.WriteString(border)
+	fmt.Fprintf(&sb, "%s: preferred, %s: non-preferred, %s: any NUMA node, %s: best hint affinity\n", mapPreferred, mapNonPreferred, mapAnyNode, mapBestHint)
+	return sb.String()
+}
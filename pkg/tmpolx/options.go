@@ -0,0 +1,151 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
+)
+
+/*
+The topology manager policy options are set like the kubelet topologyManagerPolicyOptions,
+as name=value pairs. The vendored TM (1.25) predates the policy options: when an option changes
+the merge behavior, tmpolx merges the hints with its own port of the TM code (see merge.go)
+and the result can't be cross-checked against the vendored policies.
+*/
+
+const (
+	// PreferClosestNUMANodes breaks the ties between equally wide masks by NUMA distance (kubelet >= 1.26)
+	PreferClosestNUMANodes = "prefer-closest-numa-nodes"
+	// MaxAllowableNUMANodes raises the NUMA nodes limit of the policies other than none (kubelet >= 1.31)
+	MaxAllowableNUMANodes = "max-allowable-numa-nodes"
+)
+
+type PolicyOptions struct {
+	PreferClosestNUMA     bool
+	MaxAllowableNUMANodes int
+}
+
+func NewPolicyOptions(opts map[string]string) (PolicyOptions, error) {
+	var names []string
+	for name := range opts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	po := PolicyOptions{
+		MaxAllowableNUMANodes: MaxNUMANodes,
+	}
+	for _, name := range names {
+		value := opts[name]
+		switch name {
+		case PreferClosestNUMANodes:
+			val, err := strconv.ParseBool(value)
+			if err != nil {
+				return po, fmt.Errorf("bad value for policy option %q: %w", name, err)
+			}
+			po.PreferClosestNUMA = val
+		case MaxAllowableNUMANodes:
+			val, err := strconv.Atoi(value)
+			if err != nil {
+				return po, fmt.Errorf("bad value for policy option %q: %w", name, err)
+			}
+			if val < MaxNUMANodes {
+				return po, fmt.Errorf("the minimum value of policy option %q is %d (got %d)", name, MaxNUMANodes, val)
+			}
+			if val > MaxBitmaskNUMANodes {
+				return po, fmt.Errorf("the maximum value of policy option %q is %d (got %d)", name, MaxBitmaskNUMANodes, val)
+			}
+			po.MaxAllowableNUMANodes = val
+		default:
+			return po, fmt.Errorf("unknown policy option: %q", name)
+		}
+	}
+	return po, nil
+}
+
+// String renders the options which differ from the defaults like the kubelet flags, empty if none does
+func (po PolicyOptions) String() string {
+	var items []string
+	if po.MaxAllowableNUMANodes != MaxNUMANodes {
+		items = append(items, fmt.Sprintf("%s=%d", MaxAllowableNUMANodes, po.MaxAllowableNUMANodes))
+	}
+	if po.PreferClosestNUMA {
+		items = append(items, PreferClosestNUMANodes+"=true")
+	}
+	return strings.Join(items, ",")
+}
+
+// preferClosest tells if the policy breaks ties by NUMA distance. Like in TM, single-numa-node ignores the option.
+func (tmpx *TMPolx) preferClosest() bool {
+	if !tmpx.options.PreferClosestNUMA {
+		return false
+	}
+	name := tmpx.policy.Name()
+	return name == topologymanager.PolicyBestEffort || name == topologymanager.PolicyRestricted
+}
+
+// averageDistance mirrors the TM NUMADistances.CalculateAverageFor
+func (tmpx *TMPolx) averageDistance(mask bitmask.BitMask) float64 {
+	if mask.Count() == 0 {
+		return 0
+	}
+	var count, sum float64
+	for _, node1 := range mask.GetBits() {
+		for _, node2 := range mask.GetBits() {
+			// validated in NewFromParams
+			dist, _ := tmpx.machine.Distance(node1, node2)
+			sum += float64(dist)
+			count++
+		}
+	}
+	return sum / count
+}
+
+// fitterHint picks the best between two hints of the same preference. Mirrors the TM compareHints
+// narrowness checks and, if enabled, the TM NUMAInfo.Closest. If the NUMA distance decided, tells how.
+func (tmpx *TMPolx) fitterHint(current, candidate *topologymanager.TopologyHint) (*topologymanager.TopologyHint, string) {
+	if tmpx.preferClosest() && current.NUMANodeAffinity.Count() == candidate.NUMANodeAffinity.Count() && !candidate.NUMANodeAffinity.IsEqual(current.NUMANodeAffinity) {
+		curDist := tmpx.averageDistance(current.NUMANodeAffinity)
+		candDist := tmpx.averageDistance(candidate.NUMANodeAffinity)
+		if candDist < curDist {
+			return candidate, fmt.Sprintf("closer: distance %s < %s", formatDistance(candDist), formatDistance(curDist))
+		}
+		if candDist > curDist {
+			return current, fmt.Sprintf("farther: distance %s > %s", formatDistance(candDist), formatDistance(curDist))
+		}
+		// same count, so IsNarrowerThan picks the mask with the lower NUMA nodes, like TM does
+		how := fmt.Sprintf("same distance %s", formatDistance(curDist))
+		if candidate.NUMANodeAffinity.IsNarrowerThan(current.NUMANodeAffinity) {
+			return candidate, how
+		}
+		return current, how
+	}
+	if candidate.NUMANodeAffinity.IsNarrowerThan(current.NUMANodeAffinity) {
+		return candidate, ""
+	}
+	return current, ""
+}
+
+func formatDistance(dist float64) string {
+	return strconv.FormatFloat(dist, 'f', -1, 64)
+}
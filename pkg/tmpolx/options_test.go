@@ -0,0 +1,234 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fromanirh/tmpolx/pkg/machine"
+)
+
+// newFourNodesMachine returns the machine of the TM (1.26) commonNUMAInfoFourNodes:
+// two sockets with two NUMA nodes each
+func newFourNodesMachine() *machine.Machine {
+	return &machine.Machine{
+		NUMANodes: []machine.NUMANode{
+			{ID: 0, CPUs: "0-3", Distances: []int{10, 11, 12, 12}},
+			{ID: 1, CPUs: "4-7", Distances: []int{11, 10, 12, 12}},
+			{ID: 2, CPUs: "8-11", Distances: []int{12, 12, 10, 11}},
+			{ID: 3, CPUs: "12-15", Distances: []int{12, 12, 11, 10}},
+		},
+	}
+}
+
+// The cases follow the TM (1.26) TestPolicyBestEffortMergeClosestNUMA and TestPolicyRestrictedMergeClosestNUMA.
+// Without the option the merge must give the result of the vendored policy.
+func TestPreferClosestNUMAMerge(t *testing.T) {
+	type testCase struct {
+		name     string
+		policy   string
+		hints    []string
+		expected string
+		admit    bool
+		// expectedWithout is the best hint without the option, when it differs
+		expectedWithout string
+	}
+
+	testCases := []testCase{
+		{
+			name:            "equally wide preferred masks, the closest wins",
+			policy:          "best-effort",
+			hints:           []string{"cpu:[{0110 true} {1100 true} {1111 false}]"},
+			expected:        "{1100 true}",
+			admit:           true,
+			expectedWithout: "{0110 true}",
+		},
+		{
+			name:            "equally wide preferred masks, the closest wins (restricted)",
+			policy:          "restricted",
+			hints:           []string{"cpu:[{0110 true} {1100 true} {1111 false}]"},
+			expected:        "{1100 true}",
+			admit:           true,
+			expectedWithout: "{0110 true}",
+		},
+		{
+			name:     "same distance, the lowest NUMA nodes win",
+			policy:   "best-effort",
+			hints:    []string{"cpu:[{1100 true} {0011 true}]"},
+			expected: "{0011 true}",
+			admit:    true,
+		},
+		{
+			name:     "the narrowest mask wins over the closest",
+			policy:   "best-effort",
+			hints:    []string{"cpu:[{0101 true} {1000 true}]"},
+			expected: "{1000 true}",
+			admit:    true,
+		},
+		{
+			name:   "two providers, 2 hints each, same masks, the closest wins",
+			policy: "restricted",
+			hints: []string{
+				"cpu:[{0101 true} {1100 true}]",
+				"devicemanager:nvidia.com/gpu:[{0101 true} {1100 true}]",
+			},
+			expected:        "{1100 true}",
+			admit:           true,
+			expectedWithout: "{0101 true}",
+		},
+		{
+			// like in TM, merging different masks gives a non-preferred hint
+			name:   "two providers, different masks, the preferred merge wins",
+			policy: "restricted",
+			hints: []string{
+				"cpu:[{0011 true} {1100 true}]",
+				"devicemanager:nvidia.com/gpu:[{0001 true} {1100 true}]",
+			},
+			expected: "{1100 true}",
+			admit:    true,
+		},
+		{
+			name:            "no preferred hint, the closest non-preferred wins",
+			policy:          "best-effort",
+			hints:           []string{"cpu:[{0110 false} {1100 false}]"},
+			expected:        "{1100 false}",
+			admit:           true,
+			expectedWithout: "{0110 false}",
+		},
+		{
+			name:            "no preferred hint, restricted rejects the closest",
+			policy:          "restricted",
+			hints:           []string{"cpu:[{0110 false} {1100 false}]"},
+			expected:        "{1100 false}",
+			admit:           false,
+			expectedWithout: "{0110 false}",
+		},
+		{
+			name:     "single-numa-node ignores the option",
+			policy:   "single-numa-node",
+			hints:    []string{"cpu:[{0100 true} {1000 true}]"},
+			expected: "{0100 true}",
+			admit:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expectedWithout := tc.expectedWithout
+			if expectedWithout == "" {
+				expectedWithout = tc.expected
+			}
+			for _, preferClosest := range []string{"true", "false"} {
+				tmpx, err := NewFromParams(Params{
+					PolicyName:    tc.policy,
+					PolicyOptions: map[string]string{PreferClosestNUMANodes: preferClosest},
+					Machine:       newFourNodesMachine(),
+					RawHints:      tc.hints,
+				})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				bestHint, admit := tmpx.Merge()
+				expected := tc.expected
+				if preferClosest == "false" {
+					expected = expectedWithout
+				}
+				if got := tmpx.masks.Hint(bestHint); got != expected || admit != tc.admit {
+					t.Errorf("%s=%s: expected admit=%v hint=%s, got admit=%v hint=%s", PreferClosestNUMANodes, preferClosest, tc.admit, expected, admit, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPreferClosestNUMADistances(t *testing.T) {
+	type testCase struct {
+		name             string
+		policy           string
+		withoutDistances bool
+		expectedErr      bool
+	}
+
+	testCases := []testCase{
+		{name: "best-effort with distances", policy: "best-effort"},
+		{name: "best-effort without distances", policy: "best-effort", withoutDistances: true, expectedErr: true},
+		{name: "restricted without distances", policy: "restricted", withoutDistances: true, expectedErr: true},
+		{name: "single-numa-node without distances", policy: "single-numa-node", withoutDistances: true},
+		{name: "none without distances", policy: "none", withoutDistances: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mach := newFourNodesMachine()
+			if tc.withoutDistances {
+				for idx := range mach.NUMANodes {
+					mach.NUMANodes[idx].Distances = nil
+				}
+			}
+			_, err := NewFromParams(Params{
+				PolicyName:    tc.policy,
+				PolicyOptions: map[string]string{PreferClosestNUMANodes: "true"},
+				Machine:       mach,
+				RawHints:      []string{"cpu:[{0001 true}]"},
+			})
+			if tc.expectedErr {
+				if err == nil || !strings.Contains(err.Error(), "NUMA distances") {
+					t.Errorf("expected a NUMA distances error, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMaxAllowableNUMANodesWarning(t *testing.T) {
+	type testCase struct {
+		name      string
+		policy    string
+		numaNodes []int
+		expected  bool
+	}
+
+	testCases := []testCase{
+		{name: "raised limit, few NUMA nodes", policy: "restricted", numaNodes: []int{0, 1}},
+		{name: "raised limit, NUMA nodes above the default", policy: "restricted", numaNodes: []int{0, 1, 2, 3, 4, 5, 6, 7, 8}, expected: true},
+		{name: "none policy, NUMA nodes above the default", policy: "none", numaNodes: []int{0, 1, 2, 3, 4, 5, 6, 7, 8}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpx, err := NewFromParams(Params{
+				PolicyName:    tc.policy,
+				PolicyOptions: map[string]string{MaxAllowableNUMANodes: "16"},
+				NUMANodes:     tc.numaNodes,
+				RawHints:      []string{"cpu:[{01 true}]"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := false
+			for _, warning := range tmpx.GetWarnings() {
+				got = got || strings.Contains(warning, MaxAllowableNUMANodes)
+			}
+			if got != tc.expected {
+				t.Errorf("expected the %s warning=%v, got warnings %v", MaxAllowableNUMANodes, tc.expected, tmpx.GetWarnings())
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"sigs.k8s.io/yaml"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+// HintResult is a topology hint. The Bitmask is in binary format, like the kubelet logs it.
+// NUMANodes and Bitmask are omitted if the hint has no NUMA affinity.
+type HintResult struct {
+	NUMANodes []int  `json:"numaNodes,omitempty"`
+	Bitmask   string `json:"bitmask,omitempty"`
+	Preferred bool   `json:"preferred"`
+}
+
+// ResourceResult holds the hints of a resource. Hints is null if the provider has
+// no preference for the resource, and empty if there is no possible NUMA affinity.
+type ResourceResult struct {
+	Name  string       `json:"name"`
+	Hints []HintResult `json:"hints"`
+}
+
+type ProviderResult struct {
+	Name      string           `json:"name"`
+	Resources []ResourceResult `json:"resources"`
+}
+
+type Result struct {
+	Policy    string           `json:"policy"`
+	Scope     string           `json:"scope"`
+	NUMANodes []int            `json:"numaNodes"`
+	Providers []ProviderResult `json:"providers"`
+	BestHint  HintResult       `json:"bestHint"`
+	Admit     bool             `json:"admit"`
+	// PolicyOptions are the enabled policy options, if any
+	PolicyOptions string `json:"policyOptions,omitempty"`
+	// Distance is the average NUMA distance the best hint was scored on, if the policy considered it
+	Distance *float64 `json:"distance,omitempty"`
+	// Permutations is the number of hint permutations the policy evaluated
+	Permutations int      `json:"permutations"`
+	Warnings     []string `json:"warnings,omitempty"`
+	// Diagnosis explains why the hints were rejected
+	Diagnosis *Diagnosis `json:"diagnosis,omitempty"`
+
+	// Hint is the merged best hint, as returned by the policy
+	Hint  topologymanager.TopologyHint `json:"-"`
+	masks tmhints.MaskFormatter
+}
+
+func NewHintResult(hint topologymanager.TopologyHint) HintResult {
+	hr := HintResult{
+		Preferred: hint.Preferred,
+	}
+	if hint.NUMANodeAffinity != nil {
+		hr.NUMANodes = hint.NUMANodeAffinity.GetBits()
+		hr.Bitmask = hint.NUMANodeAffinity.String()
+	}
+	return hr
+}
+
+func newHintResults(hints []topologymanager.TopologyHint) []HintResult {
+	if hints == nil {
+		return nil
+	}
+	hrs := make([]HintResult, 0, len(hints))
+	for _, hint := range hints {
+		hrs = append(hrs, NewHintResult(hint))
+	}
+	return hrs
+}
+
+func (tmpx *TMPolx) newResult(bestHint topologymanager.TopologyHint, admit bool) Result {
+	res := Result{
+		Policy:        tmpx.policy.Name(),
+		Scope:         tmpx.scope,
+		NUMANodes:     tmpx.numaNodes,
+		BestHint:      NewHintResult(bestHint),
+		Admit:         admit,
+		PolicyOptions: tmpx.options.String(),
+		Permutations:  tmpx.countPermutations(),
+		Warnings:      tmpx.warnings,
+		Hint:          bestHint,
+		masks:         tmpx.masks,
+	}
+	if tmpx.preferClosest() && bestHint.NUMANodeAffinity != nil {
+		dist := tmpx.averageDistance(bestHint.NUMANodeAffinity)
+		res.Distance = &dist
+	}
+	if !admit {
+		res.Diagnosis = tmpx.Diagnose()
+	}
+	for _, ph := range tmpx.providers {
+		pr := ProviderResult{
+			Name:      ph.Name,
+			Resources: []ResourceResult{},
+		}
+		for _, resName := range tmpx.resourceNames(ph) {
+			pr.Resources = append(pr.Resources, ResourceResult{
+				Name:  resName,
+				Hints: newHintResults(ph.Hints[resName]),
+			})
+		}
+		res.Providers = append(res.Providers, pr)
+	}
+	return res
+}
+
+// String renders the result like the kubelet logs the best hint, followed by its NUMA distance if the policy considered it
+func (res Result) String() string {
+	if res.Distance != nil {
+		return fmt.Sprintf("admit=%v hint=%s distance=%s", res.Admit, res.masks.Hint(res.Hint), formatDistance(*res.Distance))
+	}
+	return fmt.Sprintf("admit=%v hint=%s", res.Admit, res.masks.Hint(res.Hint))
+}
+
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case OutputText, OutputJSON, OutputYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format: %q", format)
+}
+
+// Render renders the result in the given output format
+func (res Result) Render(format string) (string, error) {
+	switch format {
+	case OutputText:
+		if res.Diagnosis != nil {
+			return res.String() + "\n" + res.Diagnosis.String(), nil
+		}
+		return res.String() + "\n", nil
+	case OutputJSON:
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	case OutputYAML:
+		data, err := yaml.Marshal(res)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("unknown output format: %q", format)
+}
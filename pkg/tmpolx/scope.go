@@ -0,0 +1,481 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	cadvisorapi "github.com/google/cadvisor/info/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
+	"k8s.io/kubernetes/pkg/kubelet/lifecycle"
+	"sigs.k8s.io/yaml"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+	"github.com/fromanirh/tmpolx/pkg/pod"
+)
+
+/*
+AdmitPod runs the vendored TM scope code on a pod described by a pod file (see the pod package).
+The hint providers are scripted: they report the hints of the pod file, and fail to allocate the
+resources of a container if the pod file says so (see pod.Container.AllocateErrors).
+The container scope merges the hints of each container in turn, stopping at the first rejected one;
+the pod scope merges the hints of the whole pod once, and gives the same affinity to all the containers.
+With Params.UseManager the pod goes through a real topologymanager.Manager, like the kubelet admit handler does.
+*/
+
+// The admission status of a container
+const (
+	ContainerAdmitted         = "admitted"
+	ContainerRejected         = "rejected"
+	ContainerAllocationFailed = "allocation failed"
+	ContainerSkipped          = "not evaluated"
+)
+
+const (
+	ContainerKindInit = "init"
+	ContainerKindApp  = "app"
+)
+
+// ErrManagerDiverges is returned if the manager and the bare policy merge disagree
+var ErrManagerDiverges = errors.New("the topology manager result diverges from the policy merge")
+
+// podHints are the hints the scripted providers report, for each container and for the whole pod,
+// and the errors they return allocating the resources of each container, by provider
+type podHints struct {
+	containers     map[string][]tmhints.ProviderHints
+	pod            []tmhints.ProviderHints
+	allocateErrors map[string]map[string]string
+}
+
+// providerCalls records the calls the TM makes to the scripted providers.
+// Hint requests are the container names, or an empty string for the whole pod;
+// allocations are the providers each container was allocated on, failures the provider which failed.
+type providerCalls struct {
+	hintRequests []string
+	allocations  map[string][]string
+	failures     map[string]string
+}
+
+func (pc *providerCalls) requestHints(name string) {
+	if len(pc.hintRequests) == 0 || pc.hintRequests[len(pc.hintRequests)-1] != name {
+		pc.hintRequests = append(pc.hintRequests, name)
+	}
+}
+
+// scriptedProvider is a TM HintProvider which reports the given hints
+type scriptedProvider struct {
+	name           string
+	containerHints map[string]map[string][]topologymanager.TopologyHint
+	podHints       map[string][]topologymanager.TopologyHint
+	allocateErrors map[string]string
+	calls          *providerCalls
+}
+
+var _ topologymanager.HintProvider = &scriptedProvider{}
+
+func (sp *scriptedProvider) GetTopologyHints(pod *v1.Pod, container *v1.Container) map[string][]topologymanager.TopologyHint {
+	sp.calls.requestHints(container.Name)
+	return sp.containerHints[container.Name]
+}
+
+func (sp *scriptedProvider) GetPodTopologyHints(pod *v1.Pod) map[string][]topologymanager.TopologyHint {
+	sp.calls.requestHints("")
+	return sp.podHints
+}
+
+// Allocate returns a plain error, like the kubelet resource managers do
+func (sp *scriptedProvider) Allocate(pod *v1.Pod, container *v1.Container) error {
+	if msg, ok := sp.allocateErrors[container.Name]; ok {
+		sp.calls.failures[container.Name] = sp.name
+		return errors.New(msg)
+	}
+	sp.calls.allocations[container.Name] = append(sp.calls.allocations[container.Name], sp.name)
+	return nil
+}
+
+// policyMerge is the outcome of a Policy.Merge call
+type policyMerge struct {
+	hint  topologymanager.TopologyHint
+	admit bool
+}
+
+// recordingPolicy wraps a TM policy to record the outcome of each merge, which the scopes don't expose
+type recordingPolicy struct {
+	topologymanager.Policy
+	merges []policyMerge
+}
+
+func (rp *recordingPolicy) Merge(providersHints []map[string][]topologymanager.TopologyHint) (topologymanager.TopologyHint, bool) {
+	hint, admit := rp.Policy.Merge(providersHints)
+	rp.merges = append(rp.merges, policyMerge{hint: hint, admit: admit})
+	return hint, admit
+}
+
+// ContainerResult is the admission of a container. Hint is the container affinity, or the
+// rejected best hint; it is missing if the container was not evaluated.
+type ContainerResult struct {
+	Name   string      `json:"name"`
+	Kind   string      `json:"kind"`
+	Status string      `json:"status"`
+	Hint   *HintResult `json:"hint,omitempty"`
+	// Allocated are the hint providers the container was allocated on
+	Allocated []string `json:"allocated,omitempty"`
+	// FailedProvider is the hint provider which failed to allocate the container
+	FailedProvider string `json:"failedProvider,omitempty"`
+	// Recomputed is true if the hint is the rejected best hint the topology manager doesn't expose,
+	// recomputed with the policy merge
+	Recomputed bool `json:"recomputed,omitempty"`
+
+	hint topologymanager.TopologyHint
+}
+
+// PodResult is the admission of a pod, like the TM scope computes it
+type PodResult struct {
+	Pod        string            `json:"pod"`
+	Policy     string            `json:"policy"`
+	Scope      string            `json:"scope"`
+	NUMANodes  []int             `json:"numaNodes"`
+	Containers []ContainerResult `json:"containers"`
+	Admit      bool              `json:"admit"`
+	Reason     string            `json:"reason,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	// Manager is true if the pod was admitted through a real topologymanager.Manager
+	Manager  bool     `json:"manager,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+
+	masks tmhints.MaskFormatter
+}
+
+// podFileHints parses and validates the hints of the pod file
+func (tmpx *TMPolx) podFileHints(pd *pod.Pod, lenient bool) (podHints, []string, error) {
+	hints := podHints{
+		containers:     make(map[string][]tmhints.ProviderHints),
+		allocateErrors: make(map[string]map[string]string),
+	}
+	var problems []string
+	for _, cnt := range pd.AllContainers() {
+		hints.allocateErrors[cnt.Name] = cnt.AllocateErrors
+		phs, err := cnt.ProviderHints()
+		if err != nil {
+			return hints, nil, fmt.Errorf("container %q: %w", cnt.Name, err)
+		}
+		for _, problem := range validateHints(tmpx.numaNodes, phs) {
+			problems = append(problems, fmt.Sprintf("container %q: %s", cnt.Name, problem))
+		}
+		hints.containers[cnt.Name] = phs
+	}
+	var err error
+	hints.pod, err = pd.ProviderHints()
+	if err != nil {
+		return hints, nil, fmt.Errorf("pod hints: %w", err)
+	}
+	for _, problem := range validateHints(tmpx.numaNodes, hints.pod) {
+		problems = append(problems, "pod hints: "+problem)
+	}
+
+	if len(problems) > 0 && !lenient {
+		return hints, nil, fmt.Errorf("invalid hints:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return hints, problems, nil
+}
+
+// scriptedProviders builds a provider for each provider named in the hints, in order of appearance
+func scriptedProviders(pd *pod.Pod, hints podHints, calls *providerCalls) []*scriptedProvider {
+	var providers []*scriptedProvider
+	getProvider := func(name string) *scriptedProvider {
+		for _, sp := range providers {
+			if sp.name == name {
+				return sp
+			}
+		}
+		sp := &scriptedProvider{
+			name:           name,
+			containerHints: make(map[string]map[string][]topologymanager.TopologyHint),
+			allocateErrors: make(map[string]string),
+			calls:          calls,
+		}
+		providers = append(providers, sp)
+		return sp
+	}
+	for _, cnt := range pd.AllContainers() {
+		for _, ph := range hints.containers[cnt.Name] {
+			getProvider(ph.Name).containerHints[cnt.Name] = ph.Hints
+		}
+	}
+	for _, ph := range hints.pod {
+		getProvider(ph.Name).podHints = ph.Hints
+	}
+	// a provider which only fails to allocate reports no hints, like the default one
+	for _, cnt := range pd.AllContainers() {
+		for _, name := range sortedKeys(hints.allocateErrors[cnt.Name]) {
+			getProvider(name).allocateErrors[cnt.Name] = hints.allocateErrors[cnt.Name][name]
+		}
+	}
+	if len(providers) == 0 {
+		// record the calls anyway: a provider with no hints doesn't change the merge
+		getProvider(tmhints.DefaultProvider)
+	}
+	return providers
+}
+
+// AdmitPod admits the pod with the policy and the scope set in params, like the kubelet would.
+// The hints set in params, and the cpu request, are ignored: each container has its own hints in the pod file.
+func AdmitPod(params Params, pd *pod.Pod) (PodResult, error) {
+	params.RawHints = nil
+	params.ProviderHints = nil
+	params.CPURequest = nil
+	tmpx, err := NewFromParams(params)
+	if err != nil {
+		return PodResult{}, err
+	}
+	if tmpx.scope == ScopePod && len(pd.PodHints) == 0 {
+		return PodResult{}, fmt.Errorf("pod %q: the pod scope needs the pod hints", pd.Name)
+	}
+	hints, warnings, err := tmpx.podFileHints(pd, params.Lenient)
+	if err != nil {
+		return PodResult{}, fmt.Errorf("pod %q: %w", pd.Name, err)
+	}
+	res, err := tmpx.admit(pd, hints, params.UseManager)
+	if err != nil {
+		return res, fmt.Errorf("pod %q: %w", pd.Name, err)
+	}
+	res.Warnings = append(res.Warnings, warnings...)
+	return res, nil
+}
+
+// AdmitWithManager admits a synthetic pod with a single container, whose hints (and pod hints) are the
+// ones tmpx was created with, through a real topologymanager.Manager. The result is cross-checked
+// against the policy merge; the manager doesn't expose the rejected hint, so on rejection only the
+// admission is.
+func (tmpx *TMPolx) AdmitWithManager() (PodResult, error) {
+	pd := &pod.Pod{
+		Name:       "tmpolx",
+		Namespace:  pod.DefaultNamespace,
+		Containers: []pod.Container{{Name: "tmpolx"}},
+	}
+	hints := podHints{
+		containers: map[string][]tmhints.ProviderHints{"tmpolx": tmpx.providers},
+		pod:        tmpx.providers,
+	}
+	res, err := tmpx.admit(pd, hints, true)
+	if err != nil {
+		return res, err
+	}
+
+	bestHint, admit := tmpx.Merge()
+	cr := res.Containers[0]
+	if admit != res.Admit || (tmpx.policy.Name() != topologymanager.PolicyNone && !bestHint.IsEqual(cr.hint)) {
+		return res, fmt.Errorf("%w: %s policy: manager admit=%v hint=%s, policy admit=%v hint=%s",
+			ErrManagerDiverges, tmpx.policy.Name(), res.Admit, tmpx.masks.Hint(cr.hint), admit, tmpx.masks.Hint(bestHint))
+	}
+	return res, nil
+}
+
+// admit admits the pod through the vendored scope or, if useManager is true, through a real topologymanager.Manager
+func (tmpx *TMPolx) admit(pd *pod.Pod, hints podHints, useManager bool) (PodResult, error) {
+	if tmpx.preferClosest() {
+		return PodResult{}, fmt.Errorf("the vendored scopes don't support the %s policy option", PreferClosestNUMANodes)
+	}
+
+	calls := &providerCalls{
+		allocations: make(map[string][]string),
+		failures:    make(map[string]string),
+	}
+	providers := scriptedProviders(pd, hints, calls)
+	v1pod := pd.ToV1()
+
+	if !useManager {
+		policy := &recordingPolicy{Policy: tmpx.policy}
+		var scope topologymanager.Scope
+		if tmpx.scope == ScopePod {
+			scope = topologymanager.NewPodScope(policy)
+		} else {
+			scope = topologymanager.NewContainerScope(policy)
+		}
+		for _, sp := range providers {
+			scope.AddHintProvider(sp)
+		}
+		admitRes := scope.Admit(v1pod)
+		return tmpx.newPodResult(pd, scope, policy.merges, calls, admitRes), nil
+	}
+
+	// NewManager has no policy options, so max-allowable-numa-nodes can't raise its limit
+	if tmpx.policy.Name() != topologymanager.PolicyNone && len(tmpx.numaNodes) > MaxNUMANodes {
+		return PodResult{}, fmt.Errorf("the vendored topology manager supports up to %d NUMA nodes (got %d)", MaxNUMANodes, len(tmpx.numaNodes))
+	}
+	if opts := tmpx.options.String(); opts != "" {
+		return PodResult{}, fmt.Errorf("the vendored topology manager doesn't support policy options (got %s)", opts)
+	}
+	var topology []cadvisorapi.Node
+	for _, node := range tmpx.numaNodes {
+		topology = append(topology, cadvisorapi.Node{Id: node})
+	}
+	mgr, err := topologymanager.NewManager(topology, tmpx.policy.Name(), tmpx.scope)
+	if err != nil {
+		return PodResult{}, err
+	}
+	for _, sp := range providers {
+		mgr.AddHintProvider(sp)
+	}
+	admitRes := mgr.Admit(&lifecycle.PodAdmitAttributes{Pod: v1pod})
+
+	// the manager hides its policy merges and, unlike the scopes, can't be given a recordingPolicy:
+	// recompute them on the hints of the pods or containers it asked for. Only the rejected hints
+	// come from the recomputed merges, the affinity of the admitted containers comes from the manager.
+	var merges []policyMerge
+	for _, name := range calls.hintRequests {
+		phs := hints.pod
+		if name != "" {
+			phs = hints.containers[name]
+		}
+		hint, admit := tmpx.policy.Merge(tmhints.ToProvidersHints(phs))
+		merges = append(merges, policyMerge{hint: hint, admit: admit})
+	}
+	res := tmpx.newPodResult(pd, mgr, merges, calls, admitRes)
+	res.Manager = true
+	for idx := range res.Containers {
+		res.Containers[idx].Recomputed = res.Containers[idx].Status == ContainerRejected
+	}
+	return res, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (tmpx *TMPolx) newPodResult(pd *pod.Pod, store topologymanager.Store, merges []policyMerge, calls *providerCalls, admitRes lifecycle.PodAdmitResult) PodResult {
+	res := PodResult{
+		Pod:       pd.Namespace + "/" + pd.Name,
+		Policy:    tmpx.policy.Name(),
+		Scope:     tmpx.scope,
+		NUMANodes: tmpx.numaNodes,
+		Admit:     admitRes.Admit,
+		Reason:    admitRes.Reason,
+		Message:   admitRes.Message,
+		Warnings:  tmpx.warnings,
+		masks:     tmpx.masks,
+	}
+	for idx, cnt := range pd.AllContainers() {
+		cr := ContainerResult{
+			Name:           cnt.Name,
+			Kind:           ContainerKindApp,
+			Status:         ContainerSkipped,
+			Allocated:      calls.allocations[cnt.Name],
+			FailedProvider: calls.failures[cnt.Name],
+		}
+		if pd.IsInit(cnt.Name) {
+			cr.Kind = ContainerKindInit
+		}
+
+		// which merge decided the affinity of the container, if any
+		var merge *policyMerge
+		switch {
+		case tmpx.policy.Name() == topologymanager.PolicyNone:
+			merge = &policyMerge{admit: true}
+		case tmpx.scope == ScopePod && len(merges) > 0:
+			merge = &merges[0]
+		case tmpx.scope == ScopeContainer && idx < len(merges):
+			merge = &merges[idx]
+		}
+		// an admitted container is allocated next, unless a previous allocation failed
+		allocating := len(cr.Allocated) > 0 || cr.FailedProvider != ""
+		if merge != nil && (!merge.admit || allocating) {
+			cr.Status = ContainerRejected
+			cr.hint = merge.hint
+			if merge.admit {
+				cr.Status = ContainerAdmitted
+				if cr.FailedProvider != "" {
+					cr.Status = ContainerAllocationFailed
+				}
+				cr.hint = store.GetAffinity(string(pd.UID()), cnt.Name)
+			}
+			hr := NewHintResult(cr.hint)
+			cr.Hint = &hr
+		}
+		res.Containers = append(res.Containers, cr)
+	}
+	return res
+}
+
+// String renders the affinity of each container, followed by the pod admission result
+func (res PodResult) String() string {
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "container\tkind\tstatus\thint\tallocated\n")
+	recomputed := false
+	for _, cr := range res.Containers {
+		hint := "-"
+		if cr.Hint != nil {
+			hint = res.masks.Hint(cr.hint)
+		}
+		if cr.Recomputed {
+			hint += "*"
+			recomputed = true
+		}
+		allocated := "-"
+		if len(cr.Allocated) > 0 {
+			allocated = strings.Join(cr.Allocated, ",")
+		}
+		status := cr.Status
+		if cr.FailedProvider != "" {
+			status += " on " + cr.FailedProvider
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", cr.Name, cr.Kind, status, hint, allocated)
+	}
+	tw.Flush()
+	if recomputed {
+		fmt.Fprintf(&buf, "* recomputed with the policy merge: the topology manager doesn't expose the rejected hint\n")
+	}
+
+	fmt.Fprintf(&buf, "pod %q admit=%v", res.Pod, res.Admit)
+	if !res.Admit {
+		fmt.Fprintf(&buf, " reason=%s message=%q", res.Reason, res.Message)
+	}
+	return buf.String() + "\n"
+}
+
+// Render renders the pod result in the given output format
+func (res PodResult) Render(format string) (string, error) {
+	switch format {
+	case OutputText:
+		return res.String(), nil
+	case OutputJSON:
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	case OutputYAML:
+		data, err := yaml.Marshal(res)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("unknown output format: %q", format)
+}
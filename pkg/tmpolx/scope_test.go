@@ -0,0 +1,218 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fromanirh/tmpolx/pkg/pod"
+)
+
+func TestAdmitWithManager(t *testing.T) {
+	type testCase struct {
+		name       string
+		hints      []string
+		admit      bool
+		expected   string
+		recomputed bool
+	}
+
+	testCases := []testCase{
+		{
+			name:     "admitted, the affinity comes from the manager",
+			hints:    []string{"cpu:[{01 true} {10 true} {11 false}]", "devicemanager:nvidia.com/gpu:[{10 true}]"},
+			admit:    true,
+			expected: "{10 true}",
+		},
+		{
+			name:       "rejected, the hint is recomputed",
+			hints:      []string{"cpu:[{01 true} {10 true} {11 false}]", "devicemanager:nvidia.com/gpu:[{11 true}]"},
+			expected:   "{11 false}",
+			recomputed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpx, err := NewFromParams(Params{
+				PolicyName: "restricted",
+				NUMANodes:  []int{0, 1},
+				RawHints:   tc.hints,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			res, err := tmpx.AdmitWithManager()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cr := res.Containers[0]
+			if res.Admit != tc.admit || tmpx.masks.Hint(cr.hint) != tc.expected || cr.Recomputed != tc.recomputed {
+				t.Errorf("expected admit=%v hint=%s recomputed=%v, got admit=%v hint=%s recomputed=%v",
+					tc.admit, tc.expected, tc.recomputed, res.Admit, tmpx.masks.Hint(cr.hint), cr.Recomputed)
+			}
+		})
+	}
+}
+
+func TestAdmitWithManagerNUMANodesLimit(t *testing.T) {
+	var numaNodes []int
+	for node := 0; node <= MaxNUMANodes; node++ {
+		numaNodes = append(numaNodes, node)
+	}
+	tmpx, err := NewFromParams(Params{
+		PolicyName:    "restricted",
+		PolicyOptions: map[string]string{MaxAllowableNUMANodes: "16"},
+		NUMANodes:     numaNodes,
+		RawHints:      []string{"cpu:[{01 true}]"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = tmpx.AdmitWithManager()
+	if err == nil || !strings.Contains(err.Error(), "NUMA nodes") {
+		t.Errorf("expected a NUMA nodes limit error, got %v", err)
+	}
+}
+
+// formatContainers renders the admission of each container as "name status hint", with a "*" if the hint was recomputed
+func formatContainers(res PodResult) []string {
+	var rows []string
+	for _, cr := range res.Containers {
+		hint := "-"
+		if cr.Hint != nil {
+			hint = res.masks.Hint(cr.hint)
+		}
+		if cr.Recomputed {
+			hint += "*"
+		}
+		rows = append(rows, fmt.Sprintf("%s %s %s", cr.Name, cr.Status, hint))
+	}
+	return rows
+}
+
+// The manager hides its merges, which are recomputed from the hint requests: the result must match
+// the one of the scopes, which record the merges of the policy.
+func TestAdmitPodWithManager(t *testing.T) {
+	type testCase struct {
+		name     string
+		podFile  string
+		policy   string
+		scope    string
+		admit    bool
+		expected []string
+	}
+
+	testCases := []testCase{
+		{
+			name:    "allocate error, container scope",
+			podFile: "pod-allocation-failure.yaml",
+			policy:  "restricted",
+			scope:   ScopeContainer,
+			expected: []string{
+				"setup admitted {01 true}",
+				"app allocation failed {10 true}",
+				"sidecar not evaluated -",
+			},
+		},
+		{
+			name:    "allocate error, pod scope",
+			podFile: "pod-allocation-failure.yaml",
+			policy:  "restricted",
+			scope:   ScopePod,
+			expected: []string{
+				"setup admitted {10 true}",
+				"app allocation failed {10 true}",
+				"sidecar not evaluated -",
+			},
+		},
+		{
+			name:    "rejected, pod scope",
+			podFile: "pod.yaml",
+			policy:  "restricted",
+			scope:   ScopePod,
+			expected: []string{
+				"setup rejected {11 false}*",
+				"app rejected {11 false}*",
+				"sidecar rejected {11 false}*",
+			},
+		},
+		{
+			name:    "admitted, container scope",
+			podFile: "pod.yaml",
+			policy:  "restricted",
+			scope:   ScopeContainer,
+			admit:   true,
+			expected: []string{
+				"setup admitted {01 true}",
+				"app admitted {10 true}",
+				"sidecar admitted {01 true}",
+			},
+		},
+		{
+			name:    "none policy",
+			podFile: "pod-allocation-failure.yaml",
+			policy:  "none",
+			scope:   ScopeContainer,
+			expected: []string{
+				"setup admitted {<nil> false}",
+				"app allocation failed {<nil> false}",
+				"sidecar not evaluated -",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pd, err := pod.Load("../../examples/" + tc.podFile)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			params := Params{
+				PolicyName: tc.policy,
+				ScopeName:  tc.scope,
+				NUMANodes:  []int{0, 1},
+				UseManager: true,
+			}
+			res, err := AdmitPod(params, pd)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := formatContainers(res)
+			if res.Admit != tc.admit || !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected admit=%v %v, got admit=%v %v", tc.admit, tc.expected, res.Admit, got)
+			}
+
+			params.UseManager = false
+			scopeRes, err := AdmitPod(params, pd)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// the scopes expose the rejected hints
+			var expected []string
+			for _, row := range tc.expected {
+				expected = append(expected, strings.TrimSuffix(row, "*"))
+			}
+			if got := formatContainers(scopeRes); scopeRes.Admit != tc.admit || !reflect.DeepEqual(got, expected) {
+				t.Errorf("scope: expected admit=%v %v, got admit=%v %v", tc.admit, expected, scopeRes.Admit, got)
+			}
+		})
+	}
+}
@@ -21,47 +21,140 @@ import (
 	"strings"
 	"text/tabwriter"
 
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager"
 
-	"github.com/fromanirh/cpumgrx/pkg/tmutils"
+	"github.com/fromanirh/tmpolx/pkg/cpumanager"
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+	"github.com/fromanirh/tmpolx/pkg/machine"
 )
 
 const (
-	MaxNUMANodes = 8 // TODO keep in sync with TM sources
+	// MaxNUMANodes is the default max-allowable-numa-nodes. Keep in sync with the TM sources.
+	MaxNUMANodes = 8
+	// MaxBitmaskNUMANodes is how many NUMA nodes the TM bitmask can represent
+	MaxBitmaskNUMANodes = 64
+	// PermutationsWarnThreshold is the number of hint permutations above which the merge is reported as slow
+	PermutationsWarnThreshold = 1 << 20
+)
+
+const (
+	// keep in sync with the (unexported) TM sources
+	ScopeContainer = "container"
+	ScopePod       = "pod"
 )
 
 type Params struct {
-	PolicyName   string
-	NUMANodes    []int
-	RawHints     []string
-	UseJSONHints bool
+	PolicyName string
+	// PolicyOptions are the TM policy options, like the kubelet topologyManagerPolicyOptions
+	PolicyOptions map[string]string
+	ScopeName     string
+	NUMANodes     []int
+	RawHints      []string
+	UseJSONHints  bool
+	// ProviderHints are already parsed hints, grouped by provider. They are appended
+	// to the providers parsed from RawHints as they are, even if a provider name repeats.
+	ProviderHints []tmhints.ProviderHints
+	// CPURequest, if set, generates the cpu hints like the static CPU manager policy does. Needs Machine.
+	CPURequest *cpumanager.Request
+	// MaskFormat is how NUMA affinity masks are rendered, binary if empty
+	MaskFormat string
+	// SortResources renders the resources of each provider sorted by name instead of in input order
+	SortResources bool
+	// Lenient turns the problems found validating the hints into warnings
+	Lenient bool
+	// UseManager admits the pods through a real topologymanager.Manager instead of the bare scope, see AdmitPod
+	UseManager bool
+	// Machine describes the machine topology. If NUMANodes is empty, they are taken from Machine.
+	Machine *machine.Machine
 }
 
 type TMPolx struct {
-	policy topologymanager.Policy
-	hints  map[string][]topologymanager.TopologyHint
+	machine       *machine.Machine
+	numaNodes     []int
+	policy        topologymanager.Policy
+	options       PolicyOptions
+	scope         string
+	providers     []tmhints.ProviderHints
+	masks         tmhints.MaskFormatter
+	sortResources bool
+	warnings      []string
 }
 
 func (tmpx *TMPolx) GetPolicyName() string {
 	return tmpx.policy.Name()
 }
 
+func (tmpx *TMPolx) GetScopeName() string {
+	return tmpx.scope
+}
+
+// GetMachine returns the machine topology, if known
+func (tmpx *TMPolx) GetMachine() *machine.Machine {
+	return tmpx.machine
+}
+
+func (tmpx *TMPolx) GetNUMANodes() []int {
+	return tmpx.numaNodes
+}
+
+func (tmpx *TMPolx) GetWarnings() []string {
+	return tmpx.warnings
+}
+
+func (tmpx *TMPolx) GetProviders() []string {
+	var ret []string
+	for _, ph := range tmpx.providers {
+		ret = append(ret, ph.Name)
+	}
+	return ret
+}
+
 func (tmpx *TMPolx) GetHints(resName string) []topologymanager.TopologyHint {
 	var ret []topologymanager.TopologyHint
-	for _, hint := range tmpx.hints[resName] {
-		ret = append(ret, hint)
+	for _, ph := range tmpx.providers {
+		for _, hint := range ph.Hints[resName] {
+			ret = append(ret, hint)
+		}
+	}
+	return ret
+}
+
+func (tmpx *TMPolx) GetProviderHints(provName, resName string) []topologymanager.TopologyHint {
+	var ret []topologymanager.TopologyHint
+	for _, ph := range tmpx.providers {
+		if ph.Name != provName {
+			continue
+		}
+		for _, hint := range ph.Hints[resName] {
+			ret = append(ret, hint)
+		}
 	}
 	return ret
 }
 
+// resourceNames returns the resources of the provider in input order, or sorted by name if requested
+func (tmpx *TMPolx) resourceNames(ph tmhints.ProviderHints) []string {
+	return ph.ResourceNames(tmpx.sortResources)
+}
+
 func (tmpx *TMPolx) String() string {
 	var buf strings.Builder
-	tw := tabwriter.NewWriter(&buf, 0, 8, 0, '\t', tabwriter.AlignRight)
-	fmt.Fprintf(tw, ".\tresource\thints\t\n")
-	for res, hints := range tmpx.hints {
-		fmt.Fprintf(tw, ".\t%s\t%v\t\n", res, hints)
+	tw := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, ".\tprovider\tresource\thints\n")
+	for _, ph := range tmpx.providers {
+		if len(ph.Hints) == 0 {
+			fmt.Fprintf(tw, ".\t%s\t-\tmap[]\n", ph.Name)
+			continue
+		}
+		for _, res := range tmpx.resourceNames(ph) {
+			fmt.Fprintf(tw, ".\t%s\t%s\t%s\n", ph.Name, res, tmpx.masks.Hints(ph.Hints[res]))
+		}
 	}
 	tw.Flush()
+	if opts := tmpx.options.String(); opts != "" {
+		return fmt.Sprintf("using policy %q with options %s\n%s", tmpx.policy.Name(), opts, buf.String())
+	}
 	return fmt.Sprintf("using policy %q\n%s", tmpx.policy.Name(), buf.String())
 }
 
@@ -93,8 +186,20 @@ best-effort: Run as restricted, but never fail the allocation. Fall back to allo
 */
 
 func NewFromParams(params Params) (*TMPolx, error) {
-	if len(params.NUMANodes) > MaxNUMANodes {
-		return nil, fmt.Errorf("TM currently supports up to %d NUMA nodes (got %d)", MaxNUMANodes, len(params.NUMANodes))
+	if params.Machine != nil {
+		if err := params.Machine.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid machine topology: %w", err)
+		}
+		machNodes := params.Machine.NodeIDs()
+		if len(params.NUMANodes) == 0 {
+			params.NUMANodes = machNodes
+		} else if !cpuset.NewCPUSet(params.NUMANodes...).Equals(cpuset.NewCPUSet(machNodes...)) {
+			return nil, fmt.Errorf("NUMA nodes %v don't match the machine NUMA nodes %v", params.NUMANodes, machNodes)
+		}
+	}
+
+	if len(params.NUMANodes) == 0 {
+		return nil, fmt.Errorf("no NUMA nodes")
 	}
 
 	var policy topologymanager.Policy
@@ -116,27 +221,114 @@ func NewFromParams(params Params) (*TMPolx, error) {
 		return nil, fmt.Errorf("unknown policy: %q", params.PolicyName)
 	}
 
-	var err error
-	hints := make(map[string][]topologymanager.TopologyHint)
+	options, err := NewPolicyOptions(params.PolicyOptions)
+	if err != nil {
+		return nil, err
+	}
+	// like NewManager, the none policy doesn't care about the NUMA nodes
+	if params.PolicyName != topologymanager.PolicyNone && len(params.NUMANodes) > options.MaxAllowableNUMANodes {
+		return nil, fmt.Errorf("TM supports up to %d NUMA nodes (got %d), see the %s policy option", options.MaxAllowableNUMANodes, len(params.NUMANodes), MaxAllowableNUMANodes)
+	}
+
+	scope := params.ScopeName
+	switch scope {
+	case "":
+		scope = ScopeContainer
+	case ScopeContainer, ScopePod:
+	default:
+		return nil, fmt.Errorf("unknown scope: %q", params.ScopeName)
+	}
+
+	maskFormat := params.MaskFormat
+	if maskFormat == "" {
+		maskFormat = tmhints.MaskFormatBinary
+	}
+	if err := tmhints.ValidateMaskFormat(maskFormat); err != nil {
+		return nil, err
+	}
+
+	var providers []tmhints.ProviderHints
 	if params.UseJSONHints {
-		hints, err = tmutils.ParseJSONHints(params.RawHints)
+		providers, err = tmhints.ParseJSON(params.RawHints)
 	} else {
-		hints, err = tmutils.ParseGOHints(params.RawHints)
+		providers, err = tmhints.ParseGO(params.RawHints)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	providers = append(providers, params.ProviderHints...)
+	if params.CPURequest != nil {
+		providers, err = addCPUHints(providers, params.Machine, *params.CPURequest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	problems := validateHints(params.NUMANodes, providers)
+	if len(problems) > 0 && !params.Lenient {
+		return nil, fmt.Errorf("invalid hints:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+
 	tmpx := &TMPolx{
-		hints:  hints,
-		policy: policy,
+		machine:       params.Machine,
+		numaNodes:     params.NUMANodes,
+		providers:     providers,
+		policy:        policy,
+		options:       options,
+		scope:         scope,
+		masks:         tmhints.NewMaskFormatter(maskFormat, params.NUMANodes),
+		sortResources: params.SortResources,
+		warnings:      problems,
+	}
+	// the policies which ignore the option don't need the distances
+	if tmpx.preferClosest() && (params.Machine == nil || !params.Machine.HasDistances()) {
+		return nil, fmt.Errorf("the %s policy option needs the NUMA distances of the machine topology", PreferClosestNUMANodes)
+	}
+	if params.PolicyName != topologymanager.PolicyNone && len(params.NUMANodes) > MaxNUMANodes {
+		tmpx.warnings = append(tmpx.warnings, fmt.Sprintf("%d NUMA nodes are above the default %s %d: the merge can be slow", len(params.NUMANodes), MaxAllowableNUMANodes, MaxNUMANodes))
+	}
+	if count := tmpx.countPermutations(); count > PermutationsWarnThreshold {
+		tmpx.warnings = append(tmpx.warnings, fmt.Sprintf("the policy evaluates %d hint permutations: the merge can be slow", count))
 	}
 	return tmpx, nil
 }
 
-func (tmpx *TMPolx) Run() (string, bool) {
-	allHints := []map[string][]topologymanager.TopologyHint{tmpx.hints}
-	bestHint, admit := tmpx.policy.Merge(allHints)
-	return fmt.Sprintf("%v", bestHint), admit
+// addCPUHints adds the generated cpu hints to the CPU manager provider, which must not report them already
+func addCPUHints(providers []tmhints.ProviderHints, mach *machine.Machine, req cpumanager.Request) ([]tmhints.ProviderHints, error) {
+	if mach == nil {
+		return providers, fmt.Errorf("generating the cpu hints needs the machine topology")
+	}
+	ph, err := cpumanager.ProviderHints(mach, req)
+	if err != nil {
+		return providers, fmt.Errorf("generating the cpu hints: %w", err)
+	}
+	for idx := range providers {
+		if providers[idx].Name != ph.Name {
+			continue
+		}
+		if _, ok := providers[idx].Hints[cpumanager.ResourceName]; ok {
+			return providers, fmt.Errorf("provider %q already has %s hints, can't generate them", ph.Name, cpumanager.ResourceName)
+		}
+		providers[idx].Hints[cpumanager.ResourceName] = ph.Hints[cpumanager.ResourceName]
+		providers[idx].Resources = append(providers[idx].Resources, cpumanager.ResourceName)
+		return providers, nil
+	}
+	return append(providers, ph), nil
+}
+
+// Merge merges the hints with the vendored policy or, if the policy options require it, with the ported TM code
+func (tmpx *TMPolx) Merge() (topologymanager.TopologyHint, bool) {
+	if tmpx.preferClosest() {
+		exp := tmpx.replay()
+		return exp.BestHint, exp.Admit
+	}
+	allHints := tmhints.ToProvidersHints(tmpx.providers)
+	return tmpx.policy.Merge(allHints)
+}
+
+// Run merges the hints and returns the evaluation result
+func (tmpx *TMPolx) Run() Result {
+	bestHint, admit := tmpx.Merge()
+	return tmpx.newResult(bestHint, admit)
 }
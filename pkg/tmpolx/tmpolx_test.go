@@ -0,0 +1,35 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"testing"
+)
+
+func TestNewFromParamsNoNUMANodes(t *testing.T) {
+	for _, policy := range AllPolicies {
+		t.Run(policy, func(t *testing.T) {
+			_, err := NewFromParams(Params{
+				PolicyName: policy,
+				RawHints:   []string{"cpu:[]"},
+			})
+			if err == nil {
+				t.Errorf("expected error with no NUMA nodes")
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmpolx
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
+
+	tmhints "github.com/fromanirh/tmpolx/pkg/hints"
+)
+
+// validateHints checks the hints against the configured NUMA nodes. The topology manager
+// silently ANDs each mask with the NUMA nodes, so masks with bits outside of them,
+// empty masks and duplicate masks are most likely input errors.
+func validateHints(numaNodes []int, providers []tmhints.ProviderHints) []string {
+	var problems []string
+	defaultAffinity, _ := bitmask.NewBitMask(numaNodes...)
+	for _, ph := range providers {
+		var resources []string
+		for res := range ph.Hints {
+			resources = append(resources, res)
+		}
+		sort.Strings(resources)
+
+		for _, res := range resources {
+			hints := ph.Hints[res]
+			for idx, hint := range hints {
+				if hint.NUMANodeAffinity == nil {
+					continue
+				}
+				where := fmt.Sprintf("provider %q resource %q hint #%d %v", ph.Name, res, idx+1, hint)
+				if hint.NUMANodeAffinity.IsEmpty() {
+					problems = append(problems, where+": empty NUMA affinity mask")
+					continue
+				}
+				var outside []int
+				for _, bit := range hint.NUMANodeAffinity.GetBits() {
+					if !defaultAffinity.IsSet(bit) {
+						outside = append(outside, bit)
+					}
+				}
+				if len(outside) > 0 {
+					problems = append(problems, fmt.Sprintf("%s: NUMA nodes %v are not in the configured NUMA nodes %v", where, outside, numaNodes))
+				}
+				for prev := 0; prev < idx; prev++ {
+					if hints[prev].NUMANodeAffinity != nil && hints[prev].NUMANodeAffinity.IsEqual(hint.NUMANodeAffinity) {
+						problems = append(problems, fmt.Sprintf("%s: duplicates the mask of hint #%d %v", where, prev+1, hints[prev]))
+						break
+					}
+				}
+			}
+		}
+	}
+	return problems
+}